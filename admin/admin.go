@@ -0,0 +1,480 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"webcrawler/base"
+	"webcrawler/scheduler"
+
+	"github.com/kataras/golog"
+)
+
+// 默认的监听地址。
+const DEFAULT_ADDR = "127.0.0.1:8089"
+
+// 请求体的最大字节数。
+const maxBodySize = 1 << 20
+
+// 管理服务的选项。
+type Options struct {
+	Addr string // 监听地址，必须是回环地址。为空时使用DEFAULT_ADDR。
+	// 访问令牌。若不为空，则每个请求都必须带有“Authorization: Bearer <Token>”头。
+	Token string
+	// 停止调度器时等待排空的最长时间，0表示不等待。可被stop请求的timeout参数覆盖。
+	StopTimeout time.Duration
+}
+
+// 创建管理调度器的HTTP处理器。接口如下：
+//
+//	GET  /status           结构化快照（JSON）
+//	GET  /summary          摘要信息（文本），detail=1时包含已见URL
+//	POST /pause            暂停
+//	POST /resume           恢复
+//	POST /stop             停止，timeout参数代表等待排空的最长时间，例如30s
+//	POST /seeds            添加种子，请求体为{"urls": [...]}
+//	PUT  /scope            替换爬取范围策略，请求体见scopeSpec
+//	PUT  /politeness       修改礼貌参数，请求体见politenessSpec
+//	GET  /frontier         请求缓存中的请求，limit参数代表最大数量，默认为100
+//	GET  /errors           最近的错误
+//	GET  /seen             已见URL集合（文本，每行一个）
+//
+// 为了防止其他网页通过DNS重绑定或跨站请求调用这些接口，Host头必须是回环地址或localhost，
+// 带有Origin头的请求必须与服务同源，POST和PUT请求必须带有“Content-Type: application/json”头（请求体可以为空）。
+func NewHandler(sched scheduler.Scheduler, opts Options) http.Handler {
+	s := &server{sched: sched, opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.only(http.MethodGet, s.status))
+	mux.HandleFunc("/summary", s.only(http.MethodGet, s.summary))
+	mux.HandleFunc("/pause", s.only(http.MethodPost, s.pause))
+	mux.HandleFunc("/resume", s.only(http.MethodPost, s.resume))
+	mux.HandleFunc("/stop", s.only(http.MethodPost, s.stop))
+	mux.HandleFunc("/seeds", s.only(http.MethodPost, s.addSeeds))
+	mux.HandleFunc("/scope", s.only(http.MethodPut, s.setScope))
+	mux.HandleFunc("/politeness", s.only(http.MethodPut, s.setPoliteness))
+	mux.HandleFunc("/frontier", s.only(http.MethodGet, s.frontier))
+	mux.HandleFunc("/errors", s.only(http.MethodGet, s.recentErrors))
+	mux.HandleFunc("/seen", s.only(http.MethodGet, s.seen))
+	return s.guard(s.authorize(mux))
+}
+
+// 在回环地址上启动管理服务。关闭结果值即可停止服务。
+func Listen(sched scheduler.Scheduler, opts Options) (io.Closer, error) {
+	if sched == nil {
+		return nil, errors.New("The scheduler is invalid!")
+	}
+	addr := opts.Addr
+	if addr == "" {
+		addr = DEFAULT_ADDR
+	}
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	httpServer := &http.Server{
+		Handler:           NewHandler(sched, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			golog.Errorf("Occur error when serve admin API: %s\n", err)
+		}
+	}()
+	golog.Infof("Serving admin API at http://%s\n", listener.Addr())
+	return &adminServer{server: httpServer}, nil
+}
+
+// 检查监听地址是否为回环地址。
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("Invalid admin address '%s': %s", addr, err)
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("The admin address '%s' is not a loopback address!", addr)
+	}
+	return nil
+}
+
+// 判断主机名是否为localhost或回环地址。
+func isLoopbackHost(host string) bool {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// 管理服务。
+type adminServer struct {
+	server *http.Server
+}
+
+func (as *adminServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return as.server.Shutdown(ctx)
+}
+
+// 管理接口的实现类型。
+type server struct {
+	sched scheduler.Scheduler // 被管理的调度器。
+	opts  Options             // 选项。
+}
+
+// 检查访问令牌。
+func (s *server) authorize(next http.Handler) http.Handler {
+	if s.opts.Token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + s.opts.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		actual := []byte(req.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(actual, expected) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("Invalid or missing token!"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// 拒绝可能来自其他网页的请求：Host头不是回环地址的请求（DNS重绑定）、
+// Origin头与服务不同源的请求，以及内容类型不是JSON的POST和PUT请求（无需预检的跨站请求）。
+func (s *server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !isLoopbackHost(host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("The host '%s' is not allowed!", req.Host))
+			return
+		}
+		if origin := req.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme != "http" || !strings.EqualFold(u.Host, req.Host) {
+				writeError(w, http.StatusForbidden, fmt.Errorf("The origin '%s' is not allowed!", origin))
+				return
+			}
+		}
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, errors.New("The content type must be application/json!"))
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// 只允许给定方法的请求。
+func (s *server) only(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s is not allowed!", req.Method))
+			return
+		}
+		handler(w, req)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// 解析JSON请求体。
+func readJSON(req *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(req.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("Invalid request body: %s", err)
+	}
+	return nil
+}
+
+func (s *server) status(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, s.sched.Snapshot())
+}
+
+func (s *server) summary(w http.ResponseWriter, req *http.Request) {
+	if !s.sched.Running() {
+		writeError(w, http.StatusConflict, errors.New("The scheduler is not running!"))
+		return
+	}
+	summary := s.sched.Summary("  ")
+	text := summary.String()
+	if req.URL.Query().Get("detail") == "1" {
+		text = summary.Detail()
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text)
+}
+
+func (s *server) pause(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.sched.Pause() || s.sched.Paused()})
+}
+
+func (s *server) resume(w http.ResponseWriter, req *http.Request) {
+	s.sched.Resume()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.sched.Paused()})
+}
+
+// 停止的结果。
+type stopResult struct {
+	Drained   bool   `json:"drained"`
+	Abandoned int    `json:"abandoned"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (s *server) stop(w http.ResponseWriter, req *http.Request) {
+	timeout := s.opts.StopTimeout
+	if value := req.URL.Query().Get("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid timeout '%s'!", value))
+			return
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	report, err := s.sched.Shutdown(ctx)
+	if report == nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	result := stopResult{Drained: report.Drained, Abandoned: report.Abandoned()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// 添加种子的请求体。
+type seedsSpec struct {
+	URLs []string `json:"urls"`
+}
+
+func (s *server) addSeeds(w http.ResponseWriter, req *http.Request) {
+	var spec seedsSpec
+	if err := readJSON(req, &spec); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(spec.URLs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("The seed url list is empty!"))
+		return
+	}
+	httpReqs := make([]*http.Request, 0, len(spec.URLs))
+	for _, rawURL := range spec.URLs {
+		httpReq, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid seed url '%s': %s", rawURL, err))
+			return
+		}
+		httpReqs = append(httpReqs, httpReq)
+	}
+	accepted, err := s.sched.AddSeeds(httpReqs...)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"accepted": accepted})
+}
+
+// 替换爬取范围策略的请求体。
+type scopeSpec struct {
+	// 策略的类型：same-host、same-domain、domain-list、regexp或path-prefix。
+	Type     string   `json:"type"`
+	Domains  []string `json:"domains,omitempty"`  // 用于domain-list。
+	Include  []string `json:"include,omitempty"`  // 用于regexp。
+	Exclude  []string `json:"exclude,omitempty"`  // 用于regexp。
+	Prefixes []string `json:"prefixes,omitempty"` // 用于path-prefix。
+}
+
+// 根据请求体生成爬取范围策略。
+func (spec *scopeSpec) policy() (scheduler.ScopePolicy, error) {
+	switch spec.Type {
+	case "same-host":
+		return scheduler.NewSameHostScope(), nil
+	case "same-domain":
+		return scheduler.NewSameDomainScope(), nil
+	case "domain-list":
+		return scheduler.NewDomainListScope(spec.Domains...), nil
+	case "regexp":
+		return scheduler.NewRegexpScope(spec.Include, spec.Exclude)
+	case "path-prefix":
+		return scheduler.NewPathPrefixScope(spec.Prefixes...), nil
+	default:
+		return nil, fmt.Errorf("Unknown scope type '%s'!", spec.Type)
+	}
+}
+
+func (s *server) setScope(w http.ResponseWriter, req *http.Request) {
+	var spec scopeSpec
+	if err := readJSON(req, &spec); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	scope, err := spec.policy()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.sched.SetScope(scope); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"scope": scope.String()})
+}
+
+// 主机礼貌参数的请求体。
+type hostLimitSpec struct {
+	MaxConcurrency uint32 `json:"maxConcurrency"`
+	Delay          string `json:"delay,omitempty"` // 例如500ms。
+}
+
+func (spec hostLimitSpec) limit() (base.HostLimit, error) {
+	limit := base.HostLimit{MaxConcurrency: spec.MaxConcurrency}
+	if spec.Delay != "" {
+		d, err := time.ParseDuration(spec.Delay)
+		if err != nil {
+			return limit, fmt.Errorf("Invalid delay '%s': %s", spec.Delay, err)
+		}
+		limit.Delay = d
+	}
+	return limit, nil
+}
+
+// 修改礼貌参数的请求体。
+type politenessSpec struct {
+	Default   hostLimitSpec            `json:"default"`
+	ByIP      bool                     `json:"byIP,omitempty"`
+	Overrides map[string]hostLimitSpec `json:"overrides,omitempty"`
+}
+
+func (s *server) setPoliteness(w http.ResponseWriter, req *http.Request) {
+	var spec politenessSpec
+	if err := readJSON(req, &spec); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defaultLimit, err := spec.Default.limit()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	overrides := make(map[string]base.HostLimit, len(spec.Overrides))
+	for host, hostSpec := range spec.Overrides {
+		limit, err := hostSpec.limit()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		overrides[host] = limit
+	}
+	args := base.NewPolitenessArgs(defaultLimit, spec.ByIP, overrides)
+	if err := s.sched.SetPoliteness(args); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"politeness": args.String()})
+}
+
+// 请求缓存中的请求。
+type frontierEntry struct {
+	URL       string     `json:"url"`
+	Depth     uint32     `json:"depth"`
+	Priority  float64    `json:"priority"`
+	Attempt   uint32     `json:"attempt,omitempty"`
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+}
+
+func (s *server) frontier(w http.ResponseWriter, req *http.Request) {
+	limit := 100
+	if value := req.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit '%s'!", value))
+			return
+		}
+		limit = n
+	}
+	reqs := s.sched.Frontier(limit)
+	entries := make([]frontierEntry, 0, len(reqs))
+	for _, r := range reqs {
+		entry := frontierEntry{
+			URL:      r.HttpReq().URL.String(),
+			Depth:    r.Depth(),
+			Priority: r.Priority(),
+			Attempt:  r.Attempt(),
+		}
+		if notBefore := r.NotBefore(); !notBefore.IsZero() {
+			entry.NotBefore = &notBefore
+		}
+		entries = append(entries, entry)
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// 最近的错误。
+type errorEntry struct {
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+	URL        string `json:"url,omitempty"`
+	Depth      uint32 `json:"depth,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Attempt    uint32 `json:"attempt,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+func (s *server) recentErrors(w http.ResponseWriter, req *http.Request) {
+	errs := s.sched.RecentErrors()
+	entries := make([]errorEntry, 0, len(errs))
+	for _, err := range errs {
+		ctx := err.Context()
+		entries = append(entries, errorEntry{
+			Type:       string(err.Type()),
+			Message:    strings.TrimSpace(err.Error()),
+			URL:        ctx.URL,
+			Depth:      ctx.Depth,
+			Code:       ctx.Code,
+			Attempt:    ctx.Attempt,
+			StatusCode: ctx.StatusCode,
+		})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *server) seen(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="seen-urls.txt"`)
+	for _, key := range s.sched.SeenURLs() {
+		io.WriteString(w, key)
+		io.WriteString(w, "\n")
+	}
+}
@@ -7,8 +7,13 @@ import (
 	"net/url"
 	"github.com/kataras/golog"
 	"fmt"
+	"io"
+	"mime"
 )
 
+// 响应体的默认大小限制（字节）。
+const DEFAULT_BODY_LIMIT = 10 * 1024 * 1024
+
 var analyzerIdGenerator middleware.IdGenerator = middleware.NewIdGenerator()
 
 func GenAnalyzerId() uint32 {
@@ -21,11 +26,20 @@ type Analyzer interface {
 }
 
 type myAnalyzer struct {
-	id uint32
+	id        uint32
+	bodyLimit int64 //响应体的大小限制
 }
 
 func NewAnalyzer() Analyzer {
-	return &myAnalyzer{id:GenAnalyzerId()}
+	return NewAnalyzerWithLimit(DEFAULT_BODY_LIMIT)
+}
+
+//创建分析器,参数bodyLimit代表被读取的响应体的最大字节数,超出的部分会被丢弃
+func NewAnalyzerWithLimit(bodyLimit int64) Analyzer {
+	if bodyLimit <= 0 {
+		bodyLimit = DEFAULT_BODY_LIMIT
+	}
+	return &myAnalyzer{id: GenAnalyzerId(), bodyLimit: bodyLimit}
 }
 
 func (analyzer *myAnalyzer) Id() uint32 {
@@ -48,7 +62,13 @@ func (analyzer *myAnalyzer) Analyzer(respParsers []ParseResponse, resp *base.Res
 	//解析HTTP响应
 	dataList = make([]base.Data,0)
 	errorList = make([]error,0)
-	
+	//只读取一次响应体,每个解析函数都会得到一个可以从头读取的响应体
+	pctx, err := analyzer.newParseContext(resp)
+	if err != nil {
+		errorList = append(errorList, err)
+	}
+	attachContext(httpResp, pctx)
+
 	for i,respParser := range respParsers {
 		
 		if respParser == nil {
@@ -56,6 +76,7 @@ func (analyzer *myAnalyzer) Analyzer(respParsers []ParseResponse, resp *base.Res
 			errorList = append(errorList, err)
 			continue
 		}
+		httpResp.Body = pctx.NewBody()
 		pDataList,pErrorList := respParser(httpResp, respDepth)
 		if pDataList != nil {
 			for _,pData := range pDataList {
@@ -72,6 +93,49 @@ func (analyzer *myAnalyzer) Analyzer(respParsers []ParseResponse, resp *base.Res
 	return
 }
 
+// 读取响应体并创建解析上下文。读取失败时,已读取的部分仍会被保留在解析上下文中。
+func (analyzer *myAnalyzer) newParseContext(resp *base.Response) (*ParseContext, error) {
+	httpResp := resp.HttpResp()
+	pctx := &ParseContext{
+		URL:        httpResp.Request.URL,
+		Depth:      resp.Depth(),
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Request:    resp.Request(),
+		Meta:       make(map[string]interface{}),
+	}
+	if httpResp.Body == nil {
+		return pctx, nil
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, analyzer.bodyLimit+1))
+	if int64(len(body)) > analyzer.bodyLimit {
+		golog.Warnf("The response body is truncated to %d bytes. (reqUrl=%s)\n", analyzer.bodyLimit, pctx.URL)
+		body = body[:analyzer.bodyLimit]
+		pctx.Truncated = true
+	}
+	pctx.Body = body
+	if err != nil {
+		return pctx, fmt.Errorf("Occur error when read the response body: %s (reqUrl=%s)", err, pctx.URL)
+	}
+	//把文本转换为UTF-8,并让响应头与转换后的响应体保持一致
+	contentType := httpResp.Header.Get("Content-Type")
+	decoded, charset, err := decodeBody(body, contentType)
+	if err != nil {
+		return pctx, fmt.Errorf("Occur error when decode the response body from %s: %s (reqUrl=%s)",
+			charset, err, pctx.URL)
+	}
+	pctx.Body = decoded
+	pctx.Charset = charset
+	resp.SetCharset(charset)
+	if charset != "" && charset != "utf-8" {
+		if mediaType, params, err := mime.ParseMediaType(contentType); err == nil {
+			params["charset"] = "utf-8"
+			httpResp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+		}
+	}
+	return pctx, nil
+}
 
 // 添加请求值或条目值到列表。
 func appendDataList(dataList []base.Data, data base.Data, respDepth uint32) []base.Data {
@@ -85,7 +149,7 @@ func appendDataList(dataList []base.Data, data base.Data, respDepth uint32) []ba
 	}
 	newDepth := respDepth + 1
 	if req.Depth() != newDepth {
-		req = base.NewRequest(req.HttpReq(), newDepth)
+		req = req.WithDepth(newDepth)
 	}
 	return append(dataList, req)
 }
@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	textunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// 启发式检测所使用的样本的最大字节数。
+const sniffLimit = 8 * 1024
+
+// 启发式检测的候选字符集。
+var candidates = []struct {
+	name     string
+	encoding encoding.Encoding
+}{
+	{"utf-8", textunicode.UTF8},
+	{"gbk", simplifiedchinese.GBK},
+	{"big5", traditionalchinese.Big5},
+	{"shift_jis", japanese.ShiftJIS},
+}
+
+// 简体中文与繁体中文中最常用的字。
+var (
+	commonHans = "的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实"
+	commonHant = "的一是不了在人有我他這個們中來上大為和國地到以說時要就出會可也你對生能而子那得於著下自之年過發後作裡用道行所然家種事成方多經麼去法學如都同現當沒動面起看定天分還進好小部其些主樣理心她本前開但因只從想實"
+)
+
+// 检测文本的字符集。依次依据BOM、Content-Type头、meta标签进行检测，
+// 都无法确定时，若整个文本都是有效的UTF-8则使用UTF-8，
+// 否则再在UTF-8、GBK、Big5、Shift_JIS之间进行启发式检测。
+// 结果值为字符集的名称及其编码，无法检测时使用windows-1252。
+func detectCharset(body []byte, contentType string) (string, encoding.Encoding) {
+	e, name, certain := charset.DetermineEncoding(body, contentType)
+	if certain || name != "windows-1252" {
+		return name, e
+	}
+	// DetermineEncoding只检查开头的1024个字节，开头全是ASCII时会给出windows-1252。
+	if utf8.Valid(body) {
+		return "utf-8", textunicode.UTF8
+	}
+	sample := body
+	if len(sample) > sniffLimit {
+		sample = sample[:sniffLimit]
+	}
+	bestScore := 0
+	for _, c := range candidates {
+		if score := scoreEncoding(sample, c.encoding); score > bestScore {
+			bestScore = score
+			name, e = c.name, c.encoding
+		}
+	}
+	return name, e
+}
+
+// 对用某种编码解码样本的结果进行评分。常用字和假名会加分，无效的字节序列会被重罚。
+func scoreEncoding(sample []byte, enc encoding.Encoding) int {
+	decoded, _, err := transform.Bytes(enc.NewDecoder(), sample)
+	if err != nil {
+		return 0
+	}
+	score := 0
+	for i, r := range string(decoded) {
+		switch {
+		case r == unicode.ReplacementChar:
+			// 样本末尾可能截断了一个多字节字符。
+			if i < len(decoded)-3 {
+				score -= 10
+			}
+		case r >= 0x3040 && r <= 0x30FF:
+			// 平假名与全角片假名。半角片假名常常是误判的结果，不予计分。
+			score += 2
+		case strings.ContainsRune(commonHans, r) || strings.ContainsRune(commonHant, r):
+			score++
+		}
+	}
+	return score
+}
+
+// 判断响应体是否为需要解码的文本。
+func isText(body []byte, contentType string) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, suffix := range []string{"xml", "json", "javascript", "html"} {
+		if strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 把文本响应体转换为UTF-8。结果值为转换后的响应体和检测到的字符集。
+// 非文本的响应体会被原样返回，此时字符集为空。
+func decodeBody(body []byte, contentType string) ([]byte, string, error) {
+	if !isText(body, contentType) {
+		return body, "", nil
+	}
+	name, enc := detectCharset(body, contentType)
+	if name == "utf-8" {
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), name, nil
+	}
+	decoded, err := io.ReadAll(transform.NewReader(bytes.NewReader(body), enc.NewDecoder()))
+	if err != nil {
+		return body, name, err
+	}
+	return bytes.TrimPrefix(decoded, []byte("\xef\xbb\xbf")), name, nil
+}
@@ -0,0 +1,47 @@
+package analyzer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestDecodeBodyUndeclaredUTF8(t *testing.T) {
+	text := "。日本語のページです。这是一个中文页面。"
+	body := []byte("<html><head><title>test</title></head><body>" +
+		strings.Repeat("<p>plain ascii paragraph</p>\n", 64) + "<p>" + text + "</p></body></html>")
+	for _, contentType := range []string{"text/html", ""} {
+		decoded, name, err := decodeBody(body, contentType)
+		if err != nil {
+			t.Fatalf("Unexpected error (contentType=%q): %s", contentType, err)
+		}
+		if name != "utf-8" {
+			t.Errorf("Expected charset utf-8, but got %s (contentType=%q)", name, contentType)
+		}
+		if !bytes.Contains(decoded, []byte(text)) {
+			t.Errorf("The UTF-8 text is garbled (contentType=%q)", contentType)
+		}
+	}
+}
+
+func TestDecodeBodyUndeclaredGBK(t *testing.T) {
+	text := "这是一个中文页面，我们在这里说的都是简体中文。"
+	encoded, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := append([]byte("<html><body>"+strings.Repeat("<p>ascii</p>\n", 128)+"<p>"), encoded...)
+	body = append(body, []byte("</p></body></html>")...)
+	decoded, name, err := decodeBody(body, "text/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "gbk" {
+		t.Errorf("Expected charset gbk, but got %s", name)
+	}
+	if !bytes.Contains(decoded, []byte(text)) {
+		t.Errorf("The GBK text is garbled")
+	}
+}
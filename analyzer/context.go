@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"webcrawler/base"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 解析上下文。它包含了同一个响应的所有解析函数共享的信息。
+type ParseContext struct {
+	URL        *url.URL               // 响应对应的URL。
+	Depth      uint32                 // 响应的深度。
+	StatusCode int                    // 响应的状态码。
+	Header     http.Header            // 响应头。
+	Body       []byte                 // 被读取的响应体。文本会被转换为UTF-8。
+	Charset    string                 // 检测到的响应体字符集，为空表示响应体不是文本。
+	Truncated  bool                   // 响应体是否因超出大小限制而被截断。
+	Request    *base.Request          // 响应对应的请求，可能为nil。
+	Meta       map[string]interface{} // 元数据，供各解析函数之间传递信息。
+	doc        *goquery.Document      // 解析后的DOM。
+	docErr     error                  // 解析DOM时发生的错误。
+	docParsed  bool                   // DOM是否已被解析。
+}
+
+// 获得响应体的文本。
+func (pctx *ParseContext) Text() string {
+	return string(pctx.Body)
+}
+
+// 获得解析后的DOM。DOM只会在第一次调用时被解析。
+func (pctx *ParseContext) Document() (*goquery.Document, error) {
+	if !pctx.docParsed {
+		pctx.doc, pctx.docErr = goquery.NewDocumentFromReader(bytes.NewReader(pctx.Body))
+		if pctx.doc != nil {
+			pctx.doc.Url = pctx.URL
+		}
+		pctx.docParsed = true
+	}
+	return pctx.doc, pctx.docErr
+}
+
+// 获得可重复读取的响应体。每次调用都会返回一个从头开始读取的新的读取器。
+func (pctx *ParseContext) NewBody() io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(pctx.Body))
+}
+
+// 用于在请求的上下文中存取解析上下文的键。
+type parseContextKey struct{}
+
+// 获得与HTTP响应关联的解析上下文。
+// 在分析器调用解析函数期间，解析函数可以用它获得解析上下文。若不存在，则返回nil。
+func ContextOf(httpResp *http.Response) *ParseContext {
+	if httpResp == nil || httpResp.Request == nil {
+		return nil
+	}
+	pctx, _ := httpResp.Request.Context().Value(parseContextKey{}).(*ParseContext)
+	return pctx
+}
+
+// 获得HTTP响应的DOM。若存在解析上下文，则复用其中已解析的DOM，否则会读取并关闭响应体。
+func DocumentOf(httpResp *http.Response) (*goquery.Document, error) {
+	if pctx := ContextOf(httpResp); pctx != nil {
+		return pctx.Document()
+	}
+	defer httpResp.Body.Close()
+	return goquery.NewDocumentFromReader(httpResp.Body)
+}
+
+// 把解析上下文关联到HTTP响应。
+func attachContext(httpResp *http.Response, pctx *ParseContext) {
+	ctx := context.WithValue(httpResp.Request.Context(), parseContextKey{}, pctx)
+	httpResp.Request = httpResp.Request.WithContext(ctx)
+}
+
+// 被用于解析页面的函数类型。它直接使用解析上下文，而不是HTTP响应。
+type ParsePage func(pctx *ParseContext) ([]base.Data, []error)
+
+// 把页面解析函数适配为响应解析函数。
+func AdaptParsePage(parsePage ParsePage) ParseResponse {
+	return func(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+		pctx := ContextOf(httpResp)
+		if pctx == nil {
+			return nil, []error{errors.New("The parse context is not found!")}
+		}
+		return parsePage(pctx)
+	}
+}
@@ -0,0 +1,255 @@
+package links
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"webcrawler/analyzer"
+	"webcrawler/base"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// 默认被提取的标签及其属性：页面之间的链接。
+	PageTags = map[string][]string{
+		"a":      {"href"},
+		"area":   {"href"},
+		"link":   {"href"},
+		"iframe": {"src"},
+		"frame":  {"src"},
+	}
+	// 媒体资源的标签及其属性，可以与PageTags合并使用。
+	MediaTags = map[string][]string{
+		"img":    {"src", "srcset"},
+		"source": {"src", "srcset"},
+		"video":  {"src", "poster"},
+		"audio":  {"src"},
+	}
+)
+
+// 链接提取器的配置。零值代表默认配置。
+type Config struct {
+	// 被提取的标签及其属性。若为nil，则使用PageTags。
+	// 名为srcset的属性会被按照候选列表解析。
+	Tags map[string][]string
+	// rel属性中包含其中任意一个值的标签会被忽略。若为nil，则忽略nofollow。
+	SkipRels []string
+	// 是否忽略<base href>。默认情况下相对URL会依据<base href>解析。
+	IgnoreBaseHref bool
+	// 是否保留URL中的片段（#之后的部分）。
+	KeepFragment bool
+	// 允许的URL协议。若为nil，则只允许http和https。
+	Schemes []string
+	// URL必须匹配其中至少一个正则表达式。若为空，则不做限制。
+	Include []string
+	// 匹配其中任意一个正则表达式的URL会被忽略。
+	Exclude []string
+}
+
+// 链接提取器。
+type extractor struct {
+	tags     map[string][]string // 标签及其属性。
+	selector string              // 标签的选择器。
+	skipRels map[string]bool     // 需要忽略的rel值。
+	useBase  bool                // 是否依据<base href>解析。
+	keepFrag bool                // 是否保留片段。
+	schemes  map[string]bool     // 允许的URL协议。
+	include  []*regexp.Regexp    // 包含规则。
+	exclude  []*regexp.Regexp    // 排除规则。
+}
+
+// 创建提取链接的响应解析函数。
+// 它只会解析状态码为2xx的HTML响应，并返回深度为响应深度加1的请求。
+func NewParser(config Config) (analyzer.ParseResponse, error) {
+	ext := &extractor{
+		tags:     config.Tags,
+		skipRels: make(map[string]bool),
+		useBase:  !config.IgnoreBaseHref,
+		keepFrag: config.KeepFragment,
+		schemes:  make(map[string]bool),
+	}
+	if ext.tags == nil {
+		ext.tags = PageTags
+	}
+	if len(ext.tags) == 0 {
+		return nil, errors.New("The tag set of link extractor is empty!")
+	}
+	names := make([]string, 0, len(ext.tags))
+	for tag := range ext.tags {
+		names = append(names, tag)
+	}
+	ext.selector = strings.Join(names, ",")
+	skipRels := config.SkipRels
+	if skipRels == nil {
+		skipRels = []string{"nofollow"}
+	}
+	for _, rel := range skipRels {
+		ext.skipRels[strings.ToLower(rel)] = true
+	}
+	schemes := config.Schemes
+	if schemes == nil {
+		schemes = []string{"http", "https"}
+	}
+	for _, scheme := range schemes {
+		ext.schemes[strings.ToLower(scheme)] = true
+	}
+	var err error
+	if ext.include, err = compileAll(config.Include); err != nil {
+		return nil, err
+	}
+	if ext.exclude, err = compileAll(config.Exclude); err != nil {
+		return nil, err
+	}
+	return ext.parse, nil
+}
+
+// 编译正则表达式。
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid url pattern '%s': %s", expr, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func (ext *extractor) parse(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+	reqUrl := httpResp.Request.URL
+	// 状态码由网页下载器和重试逻辑处理，这里只是不从中提取链接。
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return nil, nil
+	}
+	if !isHTML(httpResp.Header.Get("Content-Type")) {
+		return nil, nil
+	}
+	doc, err := analyzer.DocumentOf(httpResp)
+	if err != nil {
+		return nil, []error{err}
+	}
+	baseUrl := reqUrl
+	if ext.useBase {
+		if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+			if u, err := reqUrl.Parse(strings.TrimSpace(href)); err == nil {
+				baseUrl = u
+			}
+		}
+	}
+	dataList := make([]base.Data, 0)
+	errs := make([]error, 0)
+	seen := make(map[string]bool)
+	doc.Find(ext.selector).Each(func(index int, sel *goquery.Selection) {
+		if ext.skipped(sel) {
+			return
+		}
+		tag := goquery.NodeName(sel)
+		for _, attr := range ext.tags[tag] {
+			value, ok := sel.Attr(attr)
+			if !ok {
+				continue
+			}
+			var refs []string
+			if attr == "srcset" {
+				refs = parseSrcset(value)
+			} else {
+				refs = []string{value}
+			}
+			for _, ref := range refs {
+				link, ok := ext.resolve(baseUrl, ref)
+				if !ok || seen[link] {
+					continue
+				}
+				seen[link] = true
+				httpReq, err := http.NewRequest("GET", link, nil)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				dataList = append(dataList, base.NewRequest(httpReq, respDepth+1))
+			}
+		}
+	})
+	return dataList, errs
+}
+
+// 判断标签是否因其rel属性而应被忽略。
+func (ext *extractor) skipped(sel *goquery.Selection) bool {
+	rel, ok := sel.Attr("rel")
+	if !ok {
+		return false
+	}
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if ext.skipRels[r] {
+			return true
+		}
+	}
+	return false
+}
+
+// 把引用解析为绝对URL，并检查其是否应被提取。
+func (ext *extractor) resolve(baseUrl *url.URL, ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return "", false
+	}
+	u, err := baseUrl.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	if !ext.schemes[strings.ToLower(u.Scheme)] || u.Host == "" {
+		return "", false
+	}
+	if !ext.keepFrag {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	link := u.String()
+	if len(ext.include) > 0 && !matchAny(ext.include, link) {
+		return "", false
+	}
+	if matchAny(ext.exclude, link) {
+		return "", false
+	}
+	return link, true
+}
+
+// 判断字符串是否匹配任意一个正则表达式。
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析srcset属性，返回其中的所有URL。
+func parseSrcset(srcset string) []string {
+	refs := make([]string, 0)
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			refs = append(refs, fields[0])
+		}
+	}
+	return refs
+}
+
+// 判断内容类型是否为HTML。内容类型缺失时视为HTML。
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
@@ -6,5 +6,6 @@ import (
 )
 
 //被用于解析HTTP响应的函数类型
+//响应体可以被每个解析函数完整地读取一次,解析上下文可以通过ContextOf获得
 type ParseResponse func(httpResp *http.Response, respDepth uint32) ([]base.Data, []error)
 
@@ -0,0 +1,236 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"webcrawler/base"
+)
+
+// 后备路由的名称。没有匹配任何路由的响应会被计入其中。
+const FALLBACK_ROUTE = "<fallback>"
+
+// 判断响应是否匹配路由的函数类型。
+type Predicate func(httpResp *http.Response, respDepth uint32) bool
+
+// 创建根据MIME类型匹配的函数。类型可以是“text/html”形式，也可以是“image/*”形式。
+// 响应没有Content-Type头时，会根据响应体的内容推断其类型。
+func MatchMIME(types ...string) Predicate {
+	patterns := make([]string, 0, len(types))
+	for _, t := range types {
+		patterns = append(patterns, strings.ToLower(strings.TrimSpace(t)))
+	}
+	return func(httpResp *http.Response, respDepth uint32) bool {
+		mediaType := mediaTypeOf(httpResp)
+		for _, pattern := range patterns {
+			if pattern == mediaType || pattern == "*/*" {
+				return true
+			}
+			if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 获得响应的MIME类型。
+func mediaTypeOf(httpResp *http.Response) string {
+	contentType := httpResp.Header.Get("Content-Type")
+	if contentType == "" {
+		if pctx := ContextOf(httpResp); pctx != nil {
+			contentType = http.DetectContentType(pctx.Body)
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// 创建根据URL模式匹配的函数。
+func MatchURL(pattern string) (Predicate, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid url pattern '%s': %s", pattern, err)
+	}
+	return func(httpResp *http.Response, respDepth uint32) bool {
+		return re.MatchString(httpResp.Request.URL.String())
+	}, nil
+}
+
+// 创建根据状态码范围匹配的函数。范围包含两端。
+func MatchStatus(min int, max int) Predicate {
+	return func(httpResp *http.Response, respDepth uint32) bool {
+		return httpResp.StatusCode >= min && httpResp.StatusCode <= max
+	}
+}
+
+// 创建根据深度范围匹配的函数。范围包含两端。
+func MatchDepth(min uint32, max uint32) Predicate {
+	return func(httpResp *http.Response, respDepth uint32) bool {
+		return respDepth >= min && respDepth <= max
+	}
+}
+
+// 创建在所有函数都匹配时才匹配的函数。
+func MatchAll(predicates ...Predicate) Predicate {
+	return func(httpResp *http.Response, respDepth uint32) bool {
+		for _, predicate := range predicates {
+			if !predicate(httpResp, respDepth) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// 解析函数路由器的接口类型。
+// 路由按照注册的顺序被逐一尝试，响应会交给每一个匹配的路由中的解析函数，
+// 除非某个匹配的路由是终止路由，此时其后的路由不再被尝试。
+type Router interface {
+	// 注册路由。名称不能为空或重复。响应匹配该路由之后仍会继续尝试其后的路由。
+	Handle(name string, predicate Predicate, parsers ...ParseResponse) error
+	// 注册终止路由。与Handle相同，但响应匹配该路由之后不再尝试其后的路由。
+	HandleFinal(name string, predicate Predicate, parsers ...ParseResponse) error
+	// 设置后备解析函数，它们会处理没有匹配任何路由的响应。
+	Fallback(parsers ...ParseResponse)
+	// 根据路由解析响应。它本身就是一个响应解析函数。
+	Parse(httpResp *http.Response, respDepth uint32) ([]base.Data, []error)
+	// 获得各路由处理过的响应的数量。
+	Counts() map[string]uint64
+	// 获得摘要信息。
+	Summary() string
+}
+
+// 创建解析函数路由器。
+func NewRouter() Router {
+	return &myRouter{counts: make(map[string]uint64)}
+}
+
+// 路由。
+type route struct {
+	name      string          // 名称。
+	predicate Predicate       // 匹配函数。
+	parsers   []ParseResponse // 解析函数。
+	final     bool            // 是否为终止路由。
+}
+
+// 解析函数路由器的实现类型。
+type myRouter struct {
+	routes   []*route          // 路由。
+	fallback []ParseResponse   // 后备解析函数。
+	counts   map[string]uint64 // 各路由的计数。
+	rwmutex  sync.RWMutex      // 读写锁。
+}
+
+func (router *myRouter) Handle(name string, predicate Predicate, parsers ...ParseResponse) error {
+	return router.handle(&route{name: name, predicate: predicate, parsers: parsers})
+}
+
+func (router *myRouter) HandleFinal(name string, predicate Predicate, parsers ...ParseResponse) error {
+	return router.handle(&route{name: name, predicate: predicate, parsers: parsers, final: true})
+}
+
+// 检查并注册路由。
+func (router *myRouter) handle(r *route) error {
+	name, predicate := r.name, r.predicate
+	if name == "" || name == FALLBACK_ROUTE {
+		return fmt.Errorf("The route name '%s' is invalid!", name)
+	}
+	if predicate == nil {
+		return errors.New("The route predicate is invalid!")
+	}
+	router.rwmutex.Lock()
+	defer router.rwmutex.Unlock()
+	for _, existing := range router.routes {
+		if existing.name == name {
+			return fmt.Errorf("The route '%s' is repeated!", name)
+		}
+	}
+	router.routes = append(router.routes, r)
+	return nil
+}
+
+func (router *myRouter) Fallback(parsers ...ParseResponse) {
+	router.rwmutex.Lock()
+	defer router.rwmutex.Unlock()
+	router.fallback = parsers
+}
+
+func (router *myRouter) Parse(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+	matched := router.match(httpResp, respDepth)
+	router.rwmutex.Lock()
+	for _, r := range matched {
+		router.counts[r.name]++
+	}
+	router.rwmutex.Unlock()
+	dataList := make([]base.Data, 0)
+	errorList := make([]error, 0)
+	pctx := ContextOf(httpResp)
+	for _, r := range matched {
+		for i, parser := range r.parsers {
+			if parser == nil {
+				errorList = append(errorList, fmt.Errorf("The parser [%d] of route '%s' is invalid!", i, r.name))
+				continue
+			}
+			if pctx != nil {
+				httpResp.Body = pctx.NewBody()
+			}
+			pDataList, pErrorList := parser(httpResp, respDepth)
+			dataList = append(dataList, pDataList...)
+			errorList = append(errorList, pErrorList...)
+		}
+	}
+	return dataList, errorList
+}
+
+// 获得所有匹配的路由。遇到匹配的终止路由时停止尝试。
+// 若没有匹配任何路由，则结果中只有后备路由。
+func (router *myRouter) match(httpResp *http.Response, respDepth uint32) []*route {
+	router.rwmutex.RLock()
+	defer router.rwmutex.RUnlock()
+	matched := make([]*route, 0)
+	for _, r := range router.routes {
+		if r.predicate(httpResp, respDepth) {
+			matched = append(matched, r)
+			if r.final {
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		matched = append(matched, &route{name: FALLBACK_ROUTE, parsers: router.fallback})
+	}
+	return matched
+}
+
+func (router *myRouter) Counts() map[string]uint64 {
+	router.rwmutex.RLock()
+	defer router.rwmutex.RUnlock()
+	counts := make(map[string]uint64, len(router.counts))
+	for name, count := range router.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+func (router *myRouter) Summary() string {
+	router.rwmutex.RLock()
+	names := make([]string, 0, len(router.routes)+1)
+	for _, r := range router.routes {
+		names = append(names, r.name)
+	}
+	names = append(names, FALLBACK_ROUTE)
+	counts := make([]string, 0, len(names))
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%s: %d", name, router.counts[name]))
+	}
+	router.rwmutex.RUnlock()
+	return fmt.Sprintf("routes: %d, counts: [%s]", len(names)-1, strings.Join(counts, ", "))
+}
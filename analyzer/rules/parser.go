@@ -0,0 +1,207 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"webcrawler/analyzer"
+	"webcrawler/base"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/kataras/golog"
+)
+
+// 条目中记录规则名称和页面URL的键。
+const (
+	ITEM_RULE_KEY = "_rule"
+	ITEM_URL_KEY  = "_url"
+)
+
+// 根据抽取规则创建响应解析函数。
+// 对于状态码为2xx的响应，URL匹配的每条规则都会被应用，每个记录都会生成一个条目。
+func NewParser(set *RuleSet) (analyzer.ParseResponse, error) {
+	compiled, err := compile(set)
+	if err != nil {
+		return nil, err
+	}
+	return func(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+		return extract(compiled, httpResp)
+	}, nil
+}
+
+// 根据规则文件创建响应解析函数。
+// 规则文件的修改时间最多每隔interval被检查一次，被修改的文件会被重新载入。
+// 重新载入失败时，会继续使用之前的规则。
+func NewFileParser(path string, interval time.Duration) (analyzer.ParseResponse, error) {
+	fp := &fileParser{path: path, interval: interval}
+	if err := fp.load(); err != nil {
+		return nil, err
+	}
+	return fp.parse, nil
+}
+
+// 根据规则文件进行解析的解析器。
+type fileParser struct {
+	path      string          // 规则文件的路径。
+	interval  time.Duration   // 检查规则文件的间隔。
+	compiled  []*compiledRule // 当前的规则。
+	modTime   time.Time       // 当前规则所对应的文件修改时间。
+	checkTime time.Time       // 最近一次检查的时间。
+	rwmutex   sync.RWMutex    // 读写锁。
+}
+
+// 载入规则文件。
+func (fp *fileParser) load() error {
+	info, err := os.Stat(fp.path)
+	if err != nil {
+		return err
+	}
+	set, err := LoadFile(fp.path)
+	if err != nil {
+		return fmt.Errorf("Can not load rule file '%s': %s", fp.path, err)
+	}
+	compiled, err := compile(set)
+	if err != nil {
+		return fmt.Errorf("Can not compile rule file '%s': %s", fp.path, err)
+	}
+	fp.compiled = compiled
+	fp.modTime = info.ModTime()
+	fp.checkTime = time.Now()
+	return nil
+}
+
+// 在必要时重新载入规则文件，并返回当前的规则。
+func (fp *fileParser) rules() []*compiledRule {
+	fp.rwmutex.RLock()
+	compiled := fp.compiled
+	due := time.Since(fp.checkTime) >= fp.interval
+	fp.rwmutex.RUnlock()
+	if !due {
+		return compiled
+	}
+	fp.rwmutex.Lock()
+	defer fp.rwmutex.Unlock()
+	if time.Since(fp.checkTime) < fp.interval {
+		return fp.compiled
+	}
+	fp.checkTime = time.Now()
+	info, err := os.Stat(fp.path)
+	if err != nil || info.ModTime().Equal(fp.modTime) {
+		return fp.compiled
+	}
+	if err := fp.load(); err != nil {
+		golog.Errorf("%s. The previous rules are still in use.\n", err)
+		return fp.compiled
+	}
+	golog.Infof("The rule file '%s' has been reloaded.\n", fp.path)
+	return fp.compiled
+}
+
+func (fp *fileParser) parse(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
+	return extract(fp.rules(), httpResp)
+}
+
+// 按照规则从响应中抽取条目。
+func extract(compiled []*compiledRule, httpResp *http.Response) ([]base.Data, []error) {
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return nil, nil
+	}
+	pageUrl := httpResp.Request.URL
+	matched := make([]*compiledRule, 0)
+	for _, rule := range compiled {
+		if rule.url == nil || rule.url.MatchString(pageUrl.String()) {
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	doc, err := analyzer.DocumentOf(httpResp)
+	if err != nil {
+		return nil, []error{err}
+	}
+	dataList := make([]base.Data, 0)
+	errs := make([]error, 0)
+	for _, rule := range matched {
+		records := doc.Selection
+		if rule.record != nil {
+			records = doc.FindMatcher(rule.record)
+		}
+		records.Each(func(index int, record *goquery.Selection) {
+			item, err := rule.extractRecord(record, pageUrl)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			if item != nil {
+				dataList = append(dataList, &item)
+			}
+		})
+	}
+	return dataList, errs
+}
+
+// 从记录中抽取条目。若缺少必需的字段，则结果值为nil。
+func (rule *compiledRule) extractRecord(record *goquery.Selection, pageUrl *url.URL) (base.Item, error) {
+	item := base.Item{
+		ITEM_RULE_KEY: rule.name,
+		ITEM_URL_KEY:  pageUrl.String(),
+	}
+	for _, field := range rule.fields {
+		sel := record
+		if field.selector != nil {
+			sel = record.FindMatcher(field.selector)
+		}
+		values := make([]interface{}, 0)
+		var err error
+		sel.EachWithBreak(func(index int, s *goquery.Selection) bool {
+			raw, ok := field.rawValue(s)
+			if !ok {
+				return true
+			}
+			value, ok := field.postProcess(raw)
+			if !ok {
+				return true
+			}
+			var typed interface{}
+			if typed, err = field.coerce(value, pageUrl); err != nil {
+				err = fmt.Errorf("Can not convert field '%s' of rule '%s' to %s: %s (url=%s)",
+					field.Name, rule.name, field.Type, err, pageUrl)
+				return false
+			}
+			values = append(values, typed)
+			return field.Multiple
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			if field.Required {
+				return nil, nil
+			}
+			continue
+		}
+		if field.Multiple {
+			item[field.Name] = values
+		} else {
+			item[field.Name] = values[0]
+		}
+	}
+	return item, nil
+}
+
+// 获得元素的原始值。
+func (cf *compiledField) rawValue(s *goquery.Selection) (string, bool) {
+	switch cf.Attr {
+	case ATTR_TEXT:
+		return s.Text(), true
+	case ATTR_HTML:
+		html, err := s.Html()
+		return html, err == nil
+	default:
+		return s.Attr(cf.Attr)
+	}
+}
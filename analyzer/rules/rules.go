@@ -0,0 +1,202 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"gopkg.in/yaml.v3"
+)
+
+// 字段值的类型。
+const (
+	TYPE_STRING = "string"
+	TYPE_INT    = "int"
+	TYPE_FLOAT  = "float"
+	TYPE_BOOL   = "bool"
+	TYPE_URL    = "url" // 依据页面的URL解析为绝对URL。
+)
+
+// 字段取值的特殊属性名。
+const (
+	ATTR_TEXT = ""     // 取元素的文本。
+	ATTR_HTML = "html" // 取元素的内部HTML。
+)
+
+// 抽取规则的集合。
+type RuleSet struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// 抽取规则。它把URL匹配的页面中的每个记录转换为一个条目。
+type Rule struct {
+	Name   string  `json:"name" yaml:"name"`     // 规则的名称。
+	URL    string  `json:"url" yaml:"url"`       // 页面URL需匹配的正则表达式，为空表示匹配所有页面。
+	Record string  `json:"record" yaml:"record"` // 记录的CSS选择器，为空表示整个页面是一个记录。
+	Fields []Field `json:"fields" yaml:"fields"` // 字段。
+}
+
+// 字段的抽取方式。
+type Field struct {
+	Name     string `json:"name" yaml:"name"`                             // 字段的名称。
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"` // 记录内元素的CSS选择器，为空表示记录本身。
+	Attr     string `json:"attr,omitempty" yaml:"attr,omitempty"`         // 取值的属性，为空表示取文本，html表示取内部HTML。
+	Regex    string `json:"regex,omitempty" yaml:"regex,omitempty"`       // 对取到的值进行后处理的正则表达式，有分组时取第一个分组。
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`         // 值的类型，为空表示string。
+	Multiple bool   `json:"multiple,omitempty" yaml:"multiple,omitempty"` // 是否取所有匹配元素的值。
+	Required bool   `json:"required,omitempty" yaml:"required,omitempty"` // 缺少该字段的记录是否应被丢弃。
+}
+
+// 解析JSON格式的抽取规则。
+func ParseJSON(data []byte) (*RuleSet, error) {
+	var set RuleSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// 解析YAML格式的抽取规则。
+func ParseYAML(data []byte) (*RuleSet, error) {
+	var set RuleSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// 从文件载入抽取规则。扩展名为.yaml或.yml的文件按YAML解析，其他文件按JSON解析。
+func LoadFile(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	default:
+		return ParseJSON(data)
+	}
+}
+
+// 编译后的抽取规则。
+type compiledRule struct {
+	name   string
+	url    *regexp.Regexp    // 可能为nil。
+	record cascadia.Selector // 可能为nil。
+	fields []*compiledField
+}
+
+// 编译后的字段。
+type compiledField struct {
+	Field
+	selector cascadia.Selector // 可能为nil。
+	regex    *regexp.Regexp    // 可能为nil。
+}
+
+// 编译抽取规则。
+func compile(set *RuleSet) ([]*compiledRule, error) {
+	if set == nil {
+		return nil, errors.New("The rule set is invalid!")
+	}
+	compiled := make([]*compiledRule, 0, len(set.Rules))
+	for i, rule := range set.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		cr := &compiledRule{name: name}
+		var err error
+		if rule.URL != "" {
+			if cr.url, err = regexp.Compile(rule.URL); err != nil {
+				return nil, fmt.Errorf("Invalid url pattern of rule '%s': %s", name, err)
+			}
+		}
+		if rule.Record != "" {
+			if cr.record, err = cascadia.Compile(rule.Record); err != nil {
+				return nil, fmt.Errorf("Invalid record selector of rule '%s': %s", name, err)
+			}
+		}
+		if len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("The rule '%s' has no fields!", name)
+		}
+		for _, field := range rule.Fields {
+			cf, err := compileField(field)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid field of rule '%s': %s", name, err)
+			}
+			cr.fields = append(cr.fields, cf)
+		}
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+// 编译字段。
+func compileField(field Field) (*compiledField, error) {
+	if field.Name == "" {
+		return nil, errors.New("The field name can not be empty!")
+	}
+	cf := &compiledField{Field: field}
+	var err error
+	if field.Selector != "" {
+		if cf.selector, err = cascadia.Compile(field.Selector); err != nil {
+			return nil, fmt.Errorf("invalid selector of field '%s': %s", field.Name, err)
+		}
+	}
+	if field.Regex != "" {
+		if cf.regex, err = regexp.Compile(field.Regex); err != nil {
+			return nil, fmt.Errorf("invalid regex of field '%s': %s", field.Name, err)
+		}
+	}
+	switch field.Type {
+	case "", TYPE_STRING, TYPE_INT, TYPE_FLOAT, TYPE_BOOL, TYPE_URL:
+	default:
+		return nil, fmt.Errorf("unsupported type '%s' of field '%s'", field.Type, field.Name)
+	}
+	return cf, nil
+}
+
+// 对字符串形式的值进行后处理。若值不存在，则第二个结果值为false。
+func (cf *compiledField) postProcess(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if cf.regex != nil {
+		match := cf.regex.FindStringSubmatch(value)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			value = match[1]
+		} else {
+			value = match[0]
+		}
+	}
+	return value, value != ""
+}
+
+// 把字符串形式的值转换为字段的类型。
+func (cf *compiledField) coerce(value string, pageUrl *url.URL) (interface{}, error) {
+	switch cf.Type {
+	case TYPE_INT:
+		return strconv.ParseInt(strings.ReplaceAll(value, ",", ""), 10, 64)
+	case TYPE_FLOAT:
+		return strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	case TYPE_BOOL:
+		return strconv.ParseBool(value)
+	case TYPE_URL:
+		u, err := pageUrl.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		return u.String(), nil
+	default:
+		return value, nil
+	}
+}
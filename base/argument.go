@@ -3,6 +3,9 @@ package base
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 )
 
 // 参数容器的接口。
@@ -139,3 +142,176 @@ func (args *PoolBaseArgs) PageDownloaderPoolSize() uint32 {
 func (args *PoolBaseArgs) AnalyzerPoolSize() uint32 {
 	return args.analyzerPoolSize
 }
+
+// 单个主机的礼貌参数。
+type HostLimit struct {
+	MaxConcurrency uint32        // 对该主机的最大并发请求数。0表示不限制。
+	Delay          time.Duration // 对该主机的两次请求之间的最小间隔。
+}
+
+func (limit HostLimit) String() string {
+	return fmt.Sprintf("{ maxConcurrency: %d, delay: %s }", limit.MaxConcurrency, limit.Delay)
+}
+
+// 礼貌参数容器的描述模板。
+var politenessArgsTemplate string = "{ default: %s, byIP: %v, overrides: [%s] }"
+
+// 礼貌参数的容器。
+type PolitenessArgs struct {
+	defaultLimit HostLimit            // 默认的主机礼貌参数。
+	byIP         bool                 // 是否按照主机的IP地址而不是主机名进行限制。
+	overrides    map[string]HostLimit // 针对特定主机的礼貌参数。
+	description  string               // 描述。
+}
+
+// 创建礼貌参数的容器。参数overrides的键为主机名（不含端口）。
+func NewPolitenessArgs(
+	defaultLimit HostLimit,
+	byIP bool,
+	overrides map[string]HostLimit) PolitenessArgs {
+	innerOverrides := make(map[string]HostLimit, len(overrides))
+	for host, limit := range overrides {
+		innerOverrides[strings.ToLower(host)] = limit
+	}
+	return PolitenessArgs{
+		defaultLimit: defaultLimit,
+		byIP:         byIP,
+		overrides:    innerOverrides,
+	}
+}
+
+func (args *PolitenessArgs) Check() error {
+	if args.defaultLimit.Delay < 0 {
+		return errors.New("The default crawl delay can not be negative!\n")
+	}
+	for host, limit := range args.overrides {
+		if host == "" {
+			return errors.New("The host of politeness override can not be empty!\n")
+		}
+		if limit.Delay < 0 {
+			return fmt.Errorf("The crawl delay of host '%s' can not be negative!\n", host)
+		}
+	}
+	return nil
+}
+
+func (args *PolitenessArgs) String() string {
+	if args.description == "" {
+		hosts := make([]string, 0, len(args.overrides))
+		for host := range args.overrides {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		overrides := make([]string, 0, len(hosts))
+		for _, host := range hosts {
+			overrides = append(overrides, host+": "+args.overrides[host].String())
+		}
+		args.description =
+			fmt.Sprintf(politenessArgsTemplate,
+				args.defaultLimit,
+				args.byIP,
+				strings.Join(overrides, ", "))
+	}
+	return args.description
+}
+
+// 获得默认的主机礼貌参数。
+func (args *PolitenessArgs) DefaultLimit() HostLimit {
+	return args.defaultLimit
+}
+
+// 判断是否按照主机的IP地址进行限制。
+func (args *PolitenessArgs) ByIP() bool {
+	return args.byIP
+}
+
+// 获得针对某个主机的礼貌参数。若没有针对该主机的设置，则返回默认值。
+func (args *PolitenessArgs) Limit(host string) HostLimit {
+	if limit, ok := args.overrides[strings.ToLower(host)]; ok {
+		return limit
+	}
+	return args.defaultLimit
+}
+
+// 重试参数容器的描述模板。
+var retryArgsTemplate string = "{ maxRetries: %d, baseDelay: %s, maxDelay: %s, statusCodes: %v }"
+
+// 重试参数的容器。
+type RetryArgs struct {
+	maxRetries  uint32        // 最大重试次数。
+	baseDelay   time.Duration // 首次重试前的等待时间，之后每次重试都会加倍。
+	maxDelay    time.Duration // 两次尝试之间的最大等待时间。
+	statusCodes []int         // 除429和5xx之外需要重试的状态码。
+	description string        // 描述。
+}
+
+// 创建重试参数的容器。
+// 超时、暂时性的DNS解析失败、连接被重置或关闭之类的暂时性网络错误以及状态码为429和5xx的响应总是会被重试，
+// 其他下载错误不会被重试。
+// 参数statusCodes代表其他需要重试的状态码。
+func NewRetryArgs(
+	maxRetries uint32,
+	baseDelay time.Duration,
+	maxDelay time.Duration,
+	statusCodes ...int) RetryArgs {
+	codes := make([]int, len(statusCodes))
+	copy(codes, statusCodes)
+	sort.Ints(codes)
+	return RetryArgs{
+		maxRetries:  maxRetries,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		statusCodes: codes,
+	}
+}
+
+func (args *RetryArgs) Check() error {
+	if args.baseDelay <= 0 {
+		return errors.New("The base retry delay must be positive!\n")
+	}
+	if args.maxDelay < args.baseDelay {
+		return errors.New("The max retry delay can not be less than the base retry delay!\n")
+	}
+	for _, code := range args.statusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("The retry status code %d is invalid!\n", code)
+		}
+	}
+	return nil
+}
+
+func (args *RetryArgs) String() string {
+	if args.description == "" {
+		args.description =
+			fmt.Sprintf(retryArgsTemplate,
+				args.maxRetries,
+				args.baseDelay,
+				args.maxDelay,
+				args.statusCodes)
+	}
+	return args.description
+}
+
+// 获得最大重试次数。
+func (args *RetryArgs) MaxRetries() uint32 {
+	return args.maxRetries
+}
+
+// 获得首次重试前的等待时间。
+func (args *RetryArgs) BaseDelay() time.Duration {
+	return args.baseDelay
+}
+
+// 获得两次尝试之间的最大等待时间。
+func (args *RetryArgs) MaxDelay() time.Duration {
+	return args.maxDelay
+}
+
+// 判断状态码为statusCode的响应是否需要重试。
+func (args *RetryArgs) Retryable(statusCode int) bool {
+	if statusCode == 429 || (statusCode >= 500 && statusCode <= 599) {
+		return true
+	}
+	index := sort.SearchInts(args.statusCodes, statusCode)
+	return index < len(args.statusCodes) && args.statusCodes[index] == statusCode
+}
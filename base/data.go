@@ -1,20 +1,82 @@
 package base
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 type Data interface {
 	Valid() bool //数据是否有效
 }
 //请求
 type Request struct {
-	httpReq *http.Request //HTTP请求的指针值
-	depth   uint32        //请求的深度
+	httpReq *http.Request          //HTTP请求的指针值
+	depth    uint32                 //请求的深度
+	priority float64                //请求的优先级,越大越先被调度
+	attrs    map[string]interface{} //附加属性
+	attempt   uint32                 //已重试的次数
+	notBefore time.Time              //最早可被调度的时间,零值表示不限制
 }
 
 func NewRequest(httpReq *http.Request, depth uint32) *Request {
 	return &Request{httpReq: httpReq, depth: depth}
 }
 
+//获得深度不同的请求副本,副本与原请求共享附加属性
+func (req *Request) WithDepth(depth uint32) *Request {
+	return &Request{httpReq: req.httpReq, depth: depth, priority: req.priority, attrs: req.attrs}
+}
+
+//获得重试的副本,副本与原请求共享附加属性
+//参数attempt代表已重试的次数,参数notBefore代表副本最早可被调度的时间
+func (req *Request) WithAttempt(attempt uint32, notBefore time.Time) *Request {
+	return &Request{httpReq: req.httpReq, depth: req.depth, priority: req.priority, attrs: req.attrs,
+		attempt: attempt, notBefore: notBefore}
+}
+
+//获得请求已重试的次数
+func (req *Request) Attempt() uint32 {
+	return req.attempt
+}
+
+//获得请求最早可被调度的时间
+func (req *Request) NotBefore() time.Time {
+	return req.notBefore
+}
+
+//获得请求的优先级
+func (req *Request) Priority() float64 {
+	return req.priority
+}
+
+//设置请求的优先级,应在请求被放入请求缓存之前调用
+func (req *Request) SetPriority(priority float64) {
+	req.priority = priority
+}
+
+//获得附加属性的值
+func (req *Request) Attr(key string) (interface{}, bool) {
+	v, ok := req.attrs[key]
+	return v, ok
+}
+
+//获得所有附加属性的副本
+func (req *Request) Attrs() map[string]interface{} {
+	attrs := make(map[string]interface{}, len(req.attrs))
+	for k, v := range req.attrs {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+//设置附加属性,应在请求被放入请求缓存之前调用
+func (req *Request) SetAttr(key string, value interface{}) {
+	if req.attrs == nil {
+		req.attrs = make(map[string]interface{})
+	}
+	req.attrs[key] = value
+}
+
 func (req *Request) HttpReq() *http.Request {
 	return req.httpReq
 }
@@ -30,12 +92,34 @@ func (req *Request) Valid() bool {
 type Response struct {
 	httpResp *http.Response //响应
 	depth    uint32         //请求的深度
+	req      *Request       //对应的请求,可能为nil
+	charset  string         //检测到的响应体字符集,为空表示未知
 }
 
 func NewResponse(httpResp *http.Response, depth uint32) *Response {
 	return &Response{httpResp: httpResp, depth: depth}
 }
 
+//根据请求创建响应,响应会记录其对应的请求
+func NewResponseOf(req *Request, httpResp *http.Response) *Response {
+	return &Response{httpResp: httpResp, depth: req.Depth(), req: req}
+}
+
+//获得对应的请求,若未知则为nil
+func (resp *Response) Request() *Request {
+	return resp.req
+}
+
+//获得检测到的响应体字符集,为空表示未知或者响应体不是文本
+func (resp *Response) Charset() string {
+	return resp.charset
+}
+
+//设置检测到的响应体字符集
+func (resp *Response) SetCharset(charset string) {
+	resp.charset = charset
+}
+
 func (resp *Response) HttpResp() *http.Response {
 	return resp.httpResp
 }
@@ -3,30 +3,72 @@ package base
 import (
 	"bytes"
 	"fmt"
+	"net/url"
 )
 
 const (
 	DOWNLOADER_ERROR     ErrorType = "Downloader Error"
 	ANALYZER_ERROR       ErrorType = "Analyzer Error"
 	ITEM_PROCESSOR_ERROR ErrorType = "Item Processor Error"
+	SCHEDULER_ERROR      ErrorType = "Scheduler Error"
 )
 
 type CrawlerError interface {
 	Type() ErrorType //获得错误类型
 	Error() string   //获得错误提示信息
+	Context() ErrorContext //获得错误发生时的上下文
+	Unwrap() error   //获得被包装的错误,可能为nil
 }
 
+//错误类型。它实现了error接口,因此可以使用errors.Is判断爬虫错误的类型
 type ErrorType string
 
+func (et ErrorType) Error() string {
+	return string(et)
+}
+
+//错误发生时的上下文。零值代表未知
+type ErrorContext struct {
+	URL        string //请求的URL
+	Depth      uint32 //请求的深度
+	Code       string //产生错误的组件的代号
+	Attempt    uint32 //请求已被重试的次数
+	StatusCode int    //响应的状态码
+}
+
+//获得请求URL中的主机名。若URL未知或无效则返回空字符串
+func (ctx ErrorContext) Host() string {
+	if ctx.URL == "" {
+		return ""
+	}
+	u, err := url.Parse(ctx.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
 //爬虫错误的实现
 type myCrawlerError struct {
 	errType    ErrorType //错误类型
 	errMsg     string    //错误信息
 	fullErrMsg string    //完整错误信息
+	ctx        ErrorContext //上下文
+	cause      error     //被包装的错误
 }
 
-func NewCrawLerError(errType ErrorType,errMsg string) CrawlerError {
-	return &myCrawlerError{errType:errType,errMsg:errMsg}
+//完整错误信息在创建时生成,之后错误值是只读的,可以被多个协程同时使用
+func NewCrawlerError(errType ErrorType,errMsg string) CrawlerError {
+	ce := &myCrawlerError{errType:errType,errMsg:errMsg}
+	ce.genFullErrMsg()
+	return ce
+}
+
+//创建包装了另一个错误的爬虫错误。参数cause不能为nil
+func WrapCrawlerError(errType ErrorType, cause error, ctx ErrorContext) CrawlerError {
+	ce := &myCrawlerError{errType: errType, errMsg: cause.Error(), ctx: ctx, cause: cause}
+	ce.genFullErrMsg()
+	return ce
 }
 
 func (ce *myCrawlerError) genFullErrMsg() {
@@ -45,8 +87,19 @@ func (ce *myCrawlerError) Type() ErrorType {
 }
 
 func (ce *myCrawlerError) Error() string {
-	if ce.fullErrMsg == "" {
-		ce.genFullErrMsg()
-	}
 	return ce.fullErrMsg
 }
+
+func (ce *myCrawlerError) Context() ErrorContext {
+	return ce.ctx
+}
+
+func (ce *myCrawlerError) Unwrap() error {
+	return ce.cause
+}
+
+//使errors.Is(err, DOWNLOADER_ERROR)之类的判断成立
+func (ce *myCrawlerError) Is(target error) bool {
+	errType, ok := target.(ErrorType)
+	return ok && errType == ce.errType
+}
@@ -0,0 +1,214 @@
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"webcrawler/base"
+)
+
+// 死信的种类。
+const (
+	KIND_ITEM    = "item"    // 处理失败的条目。
+	KIND_REQUEST = "request" // 下载彻底失败的请求。
+)
+
+// 死信，即处理失败的数据及其失败的原因。
+type Entry struct {
+	Kind    string    `json:"kind"`              // 种类。
+	Item    base.Item `json:"item,omitempty"`    // 条目，仅在种类为条目时存在。
+	Request *Request  `json:"request,omitempty"` // 请求，仅在种类为请求时存在。
+	Error   string    `json:"error"`             // 错误信息。
+	Code    string    `json:"code"`              // 产生错误的组件的代号。
+	Time    time.Time `json:"time"`              // 失败的时间。
+}
+
+// 死信中的请求。请求体不会被保存。
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Depth  uint32      `json:"depth"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// 为处理失败的条目创建死信。
+func NewItemEntry(item base.Item, errs []error, code string) *Entry {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return &Entry{
+		Kind:  KIND_ITEM,
+		Item:  item,
+		Error: strings.Join(msgs, "; "),
+		Code:  code,
+		Time:  time.Now(),
+	}
+}
+
+// 为下载彻底失败的请求创建死信。
+func NewRequestEntry(req *base.Request, err error, code string) *Entry {
+	httpReq := req.HttpReq()
+	return &Entry{
+		Kind: KIND_REQUEST,
+		Request: &Request{
+			Method: httpReq.Method,
+			URL:    httpReq.URL.String(),
+			Depth:  req.Depth(),
+			Header: httpReq.Header,
+		},
+		Error: err.Error(),
+		Code:  code,
+		Time:  time.Now(),
+	}
+}
+
+// 根据死信还原请求。重试次数会被清零。
+func (entry *Entry) ToRequest() (*base.Request, error) {
+	if entry.Kind != KIND_REQUEST || entry.Request == nil {
+		return nil, fmt.Errorf("The dead letter of kind '%s' is not a request!", entry.Kind)
+	}
+	httpReq, err := http.NewRequest(entry.Request.Method, entry.Request.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range entry.Request.Header {
+		httpReq.Header[k] = v
+	}
+	return base.NewRequest(httpReq, entry.Request.Depth), nil
+}
+
+// 死信存储的接口类型。它的实现类型都是并发安全的。
+type Store interface {
+	// 保存死信。
+	Put(entry *Entry) error
+	// 获得已保存的全部死信，包括之前的运行中保存的。
+	Entries() ([]*Entry, error)
+	// 获得本次运行中已保存的死信的数量。
+	Count() uint64
+	// 关闭存储。关闭之后的保存会失败。
+	Close() error
+	// 获得摘要信息。
+	Summary() string
+}
+
+// 创建基于文件的死信存储。文件中的每一行都是一个JSON对象，
+// 已存在的文件会被追加写入。
+func NewFileStore(path string) (Store, error) {
+	if path == "" {
+		return nil, errors.New("The dead letter file path can not be empty!")
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileStore{path: path, file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// 基于文件的死信存储的实现类型。
+type fileStore struct {
+	path   string        // 文件的路径。
+	file   *os.File      // 文件。
+	writer *bufio.Writer // 缓冲写入器。
+	count  uint64        // 本次运行中已保存的死信的数量。
+	mutex  sync.Mutex    // 互斥锁。
+}
+
+func (fs *fileStore) Put(entry *Entry) error {
+	if entry == nil {
+		return errors.New("The dead letter is invalid!")
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Can not encode the dead letter to JSON: %s", err)
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.writer == nil {
+		return errors.New("The dead letter store is closed!")
+	}
+	fs.writer.Write(data)
+	fs.writer.WriteByte('\n')
+	// 每条死信都会被立即写入文件，以免在崩溃时丢失。
+	if err := fs.writer.Flush(); err != nil {
+		return err
+	}
+	fs.count++
+	return nil
+}
+
+func (fs *fileStore) Entries() ([]*Entry, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.writer != nil {
+		if err := fs.writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return ReadFile(fs.path)
+}
+
+func (fs *fileStore) Count() uint64 {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.count
+}
+
+func (fs *fileStore) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.writer == nil {
+		return nil
+	}
+	err := fs.writer.Flush()
+	if syncErr := fs.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := fs.file.Close(); err == nil {
+		err = closeErr
+	}
+	fs.writer = nil
+	fs.file = nil
+	return err
+}
+
+func (fs *fileStore) Summary() string {
+	return fmt.Sprintf("path: %s, written: %d", fs.path, fs.Count())
+}
+
+// 读取死信文件中的全部死信。文件末尾不完整的一行（通常由崩溃导致）会被忽略。
+func ReadFile(path string) ([]*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(data, []byte{'\n'})
+	entries := make([]*Entry, 0, len(lines))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("Corrupted dead letter file '%s' at line %d: %s", path, i+1, err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
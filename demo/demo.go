@@ -1,19 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 	"webcrawler/analyzer"
+	"webcrawler/analyzer/links"
 	"webcrawler/base"
 	"webcrawler/itempipeline"
 	"webcrawler/scheduler"
 	"webcrawler/tool"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/kataras/golog"
 )
 
@@ -34,70 +33,35 @@ func processItem(item base.Item) (result base.Item, err error) {
 	return result, nil
 }
 
-// 响应解析函数。只解析“A”标签。
-func parseForATag(httpResp *http.Response, respDepth uint32) ([]base.Data, []error) {
-	if httpResp.StatusCode != 200 {
-		err := errors.New(fmt.Sprintf("Unsupported status code %d. (httpResponseCode=%v", httpResp))
-		return nil, []error{err}
+// 页面解析函数。只提取页面的标题。
+func parseForTitle(pctx *analyzer.ParseContext) ([]base.Data, []error) {
+	if pctx.StatusCode != 200 {
+		return nil, nil
 	}
-	var reqUrl = httpResp.Request.URL
-	var httpRespBody = httpResp.Body
-	defer func() {
-		if httpRespBody != nil {
-			httpRespBody.Close()
-		}
-	}()
-	dataList := make([]base.Data, 0)
-	errs := make([]error, 0)
-	//开始解析
-	doc, err := goquery.NewDocumentFromReader(httpRespBody)
+	doc, err := pctx.Document()
 	if err != nil {
-		errs = append(errs, err)
-		return dataList, errs
+		return nil, []error{err}
+	}
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	if title == "" {
+		return nil, nil
 	}
-	//查找A标签并提取链接地址
-	doc.Find("a").Each(func(index int, sel *goquery.Selection) {
-		href, exists := sel.Attr("href")
-		if !exists || href == "" || href == "#" || href == "/" {
-			return
-		}
-		href = strings.TrimSpace(href)
-		lowerHref := strings.ToLower(href)
-		//暂不支持对javascript代码的解析
-		if href != "" && !strings.HasPrefix(lowerHref, "javascript") {
-			aUrl, err := url.Parse(href)
-			if err != nil {
-				errs = append(errs, err)
-				return
-			}
-			if !aUrl.IsAbs() {
-				aUrl = reqUrl.ResolveReference(aUrl)
-			}
-			httpReq, err := http.NewRequest("GET", aUrl.String(), nil)
-			if err != nil {
-				errs = append(errs, err)
-			} else {
-				req := base.NewRequest(httpReq, respDepth)
-				dataList = append(dataList, req)
-			}
-		}
-		text := strings.TrimSpace(sel.Text())
-		if text != "" {
-			imap := make(map[string]interface{})
-			imap["parent_url"] = reqUrl
-			imap["a.text"] = text
-			imap["a.index"] = index
-			item := base.Item(imap)
-			dataList = append(dataList, &item)
-		}
+	item := base.Item(map[string]interface{}{
+		"url":   pctx.URL.String(),
+		"title": title,
 	})
-	return dataList, errs
+	return []base.Data{&item}, nil
 }
 
 //获得响应及诶系函数的序列
 func getResponseParsers() []analyzer.ParseResponse {
+	parseForLinks, err := links.NewParser(links.Config{})
+	if err != nil {
+		panic(err)
+	}
 	parsers := []analyzer.ParseResponse{
-		parseForATag,
+		parseForLinks,
+		analyzer.AdaptParsePage(parseForTitle),
 	}
 	return parsers
 }
@@ -126,8 +90,25 @@ func record(level byte, content string) {
 }
 
 func main() {
+	startUrl := "http://www.sogo.com"
+	firstHttpReq, err := http.NewRequest("GET", startUrl, nil)
+	if err != nil {
+		golog.Error(err, "\n")
+		return
+	}
 	//创建调度器
-	newScheduler := scheduler.NewScheduler()
+	newScheduler, err := scheduler.NewSchedulerWithOptions(
+		scheduler.WithChannelArgs(base.NewChannelArgs(10, 10, 10, 10)),
+		scheduler.WithPoolBaseArgs(base.NewPoolBaseArgs(3, 3)),
+		scheduler.WithCrawlDepth(1),
+		scheduler.WithSeeds(firstHttpReq),
+		scheduler.WithHttpClientGenerator(genHttpClient),
+		scheduler.WithRespParsers(getResponseParsers()...),
+		scheduler.WithItemProcessors(getItemProcessors()...))
+	if err != nil {
+		golog.Error(err, "\n")
+		return
+	}
 
 	// 准备监控参数
 	intervalNs := 10 * time.Millisecond
@@ -140,20 +121,11 @@ func main() {
 		false,
 		record)
 
-	channelArgs := base.NewChannelArgs(10, 10, 10, 10)
-	poolSize := base.NewPoolBaseArgs(3, 3)
-	crawDepth := uint32(1)
-	httpClientGenerator := genHttpClient
-	respParsers := getResponseParsers()
-	itemProcessors := getItemProcessors()
-	startUrl := "http://www.sogo.com"
-	firstHttpReq, err := http.NewRequest("GET", startUrl, nil)
-	if err != nil {
+	// 开启调度器
+	if err := newScheduler.Run(context.Background()); err != nil {
 		golog.Error(err, "\n")
 		return
 	}
-	// 开启调度器
-	newScheduler.Start(channelArgs, poolSize, crawDepth, httpClientGenerator, respParsers, itemProcessors, firstHttpReq)
 
 	<-checkCountChan
 }
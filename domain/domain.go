@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+)
+
+// 内嵌的公共后缀列表（Public Suffix List）快照。
+//
+//go:embed public_suffix_list.dat
+var embeddedList string
+
+// 公共后缀列表。
+type List struct {
+	rules      map[string]bool // 普通规则，例如“co.uk”。
+	wildcards  map[string]bool // 通配规则，以“*.ck”为例，其中存储的是“ck”。
+	exceptions map[string]bool // 例外规则，以“!www.ck”为例，其中存储的是“www.ck”。
+}
+
+// 从读取器中解析公共后缀列表，其格式与 https://publicsuffix.org/list/ 所发布的列表相同。
+// 规则中的国际化域名会被转换为Punycode形式。
+func Parse(r io.Reader) (*List, error) {
+	list := &List{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		// 规则只包含第一个空白字符之前的部分。
+		if index := strings.IndexAny(line, " \t"); index >= 0 {
+			line = line[:index]
+		}
+		target := list.rules
+		switch {
+		case strings.HasPrefix(line, "!"):
+			target = list.exceptions
+			line = line[1:]
+		case strings.HasPrefix(line, "*."):
+			target = list.wildcards
+			line = line[2:]
+		}
+		rule, err := idna.Lookup.ToASCII(line)
+		if err != nil {
+			rule = strings.ToLower(line)
+		}
+		target[rule] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(list.rules) == 0 {
+		return nil, errors.New("The public suffix list is empty!")
+	}
+	return list, nil
+}
+
+// 获得主机名的公共后缀。若主机名是IP地址，则返回空字符串。
+func (list *List) PublicSuffix(host string) (string, error) {
+	host, err := Normalize(host)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return "", nil
+	}
+	return list.publicSuffix(host), nil
+}
+
+// 获得已规范化的主机名的公共后缀。
+func (list *List) publicSuffix(host string) string {
+	labels := strings.Split(host, ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		if list.exceptions[suffix] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if list.rules[suffix] {
+			return suffix
+		}
+		if i+1 < len(labels) && list.wildcards[strings.Join(labels[i+1:], ".")] {
+			return suffix
+		}
+	}
+	// 默认规则“*”：最后一个标签即为公共后缀。
+	return labels[len(labels)-1]
+}
+
+// 获得主机名的可注册域名（即主域名），也就是公共后缀再加上其左侧的一个标签。
+// 若主机名是IP地址，则返回该IP地址本身。
+func (list *List) RegistrableDomain(host string) (string, error) {
+	host, err := Normalize(host)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	suffix := list.publicSuffix(host)
+	if host == suffix {
+		return "", fmt.Errorf("The host '%s' is a public suffix!", host)
+	}
+	firstPart := host[:len(host)-len(suffix)-1]
+	if index := strings.LastIndex(firstPart, "."); index >= 0 {
+		firstPart = firstPart[index+1:]
+	}
+	return firstPart + "." + suffix, nil
+}
+
+// 规范化主机名：去除端口、IPv6字面量的方括号以及末尾的点，
+// 转为小写，并把国际化域名转换为Punycode形式。
+func Normalize(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return "", errors.New("The host is empty!")
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if net.ParseIP(host) != nil {
+		return strings.ToLower(host), nil
+	}
+	host = strings.TrimSuffix(host, ".")
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		// 纯ASCII的主机名（例如含有下划线的）仍然可以使用。
+		if !isASCII(host) {
+			return "", fmt.Errorf("Invalid host '%s': %s", host, err)
+		}
+		ascii = strings.ToLower(host)
+	}
+	if ascii == "" {
+		return "", errors.New("The host is empty!")
+	}
+	return ascii, nil
+}
+
+// 判断字符串是否只包含ASCII字符。
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// 默认的公共后缀列表及其读写锁。
+var (
+	defaultList    *List
+	defaultRWMutex sync.RWMutex
+)
+
+func init() {
+	list, err := Parse(strings.NewReader(embeddedList))
+	if err != nil {
+		panic(err)
+	}
+	defaultList = list
+}
+
+// 获得默认的公共后缀列表。
+func Default() *List {
+	defaultRWMutex.RLock()
+	defer defaultRWMutex.RUnlock()
+	return defaultList
+}
+
+// 从本地文件重新加载默认的公共后缀列表。若加载失败，则仍然使用原有的列表。
+func LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	list, err := Parse(file)
+	if err != nil {
+		return fmt.Errorf("Can not load public suffix list from '%s': %s", path, err)
+	}
+	defaultRWMutex.Lock()
+	defer defaultRWMutex.Unlock()
+	defaultList = list
+	return nil
+}
+
+// 使用默认的公共后缀列表获得主机名的公共后缀。
+func PublicSuffix(host string) (string, error) {
+	return Default().PublicSuffix(host)
+}
+
+// 使用默认的公共后缀列表获得主机名的可注册域名。
+func RegistrableDomain(host string) (string, error) {
+	return Default().RegistrableDomain(host)
+}
@@ -43,5 +43,5 @@ func (dl *myPagedownloader) Download(req base.Request) (*base.Response, error) {
 	if err != nil {
 		return nil, err
 	}
-	return base.NewResponse(response, req.Depth()), err
+	return base.NewResponseOf(&req, response), err
 }
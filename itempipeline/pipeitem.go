@@ -8,14 +8,19 @@ import (
 )
 
 type ItemPipeline interface {
-	//发送条目
+	//发送条目,并等待其处理完毕
 	Send(item base.Item) []error
+	//异步地发送条目。条目处理完毕(包括被丢弃或因错误而中止)之后会调用参数done。
+	//管道繁忙时该方法会阻塞,以便把压力传递给发送方。若管道已被关闭,则返回错误
+	SendAsync(item base.Item, done func(errs []error)) error
+	//关闭管道。尚未处理完毕的条目会被放弃
+	Close()
 	//是否快速失败
 	FailFast() bool
 	//设置快速失败
 	SetFailFast(failFast bool)
-	//获得已发送,已接受和已处理的条目的计数值
-	//更确切地说,作为结果值得切片总忽悠3个元素值,分别代表已发送,已接受和已处理的计数
+	//获得已发送,已接受,已处理和已丢弃的条目的计数值
+	//更确切地说,作为结果值得切片总会有4个元素值,分别代表已发送,已接受,已处理和已丢弃的计数
 	Count() []uint64
 	//正在被处理的条目的数量
 	ProcessingNumber() uint64
@@ -29,7 +34,9 @@ type myItemPipeLine struct {
 	send             uint64 //已发送条目的数量
 	accepted         uint64 //已接受数量
 	processed        uint64 //已处理条目数量
+	dropped          uint64 //已丢弃条目数量
 	processingNumber uint64 //处理中数量
+	closed           uint32 //是否已关闭,1表示是
 }
 
 func NewItemPipeline(itemProcessors []ProcessItem) ItemPipeline {
@@ -60,6 +67,10 @@ func (it *myItemPipeLine) Send(item base.Item) []error {
 	var currentItem base.Item = item
 	for _,itemProcessor := range it.itemProcesors {
 		processedItem,err := itemProcessor(currentItem)
+		if errors.Is(err, ErrDropItem) {
+			atomic.AddUint64(&it.dropped,1)
+			return errs
+		}
 		if err != nil {
 			errs = append(errs,err)
 			if it.failFast {
@@ -74,6 +85,25 @@ func (it *myItemPipeLine) Send(item base.Item) []error {
 	return errs
 }
 
+//每个条目都会在单独的goroutine中被处理,因此该方法不会阻塞。
+//需要限制并发量时,应使用NewStagedItemPipeline创建的管道
+func (it *myItemPipeLine) SendAsync(item base.Item, done func(errs []error)) error {
+	if atomic.LoadUint32(&it.closed) == 1 {
+		return errors.New("The item pipeline is closed!")
+	}
+	go func() {
+		errs := it.Send(item)
+		if done != nil {
+			done(errs)
+		}
+	}()
+	return nil
+}
+
+func (it *myItemPipeLine) Close() {
+	atomic.StoreUint32(&it.closed, 1)
+}
+
 func (it *myItemPipeLine) FailFast() bool {
 	return it.failFast
 }
@@ -83,10 +113,11 @@ func (it *myItemPipeLine) SetFailFast(failFast bool) {
 }
 
 func (it *myItemPipeLine) Count() []uint64 {
-	counts := make([]uint64, 3)
+	counts := make([]uint64, 4)
 	counts[0] = atomic.LoadUint64(&it.send)
 	counts[1] = atomic.LoadUint64(&it.accepted)
 	counts[2] = atomic.LoadUint64(&it.processed)
+	counts[3] = atomic.LoadUint64(&it.dropped)
 	return counts
 }
 
@@ -95,12 +126,12 @@ func (it *myItemPipeLine) ProcessingNumber() uint64 {
 }
 
 var summaryTemplate = "failFast: %v, processorNumber: %d," +
-	" sent: %d, accepted: %d, processed: %d, processingNumber: %d"
+	" sent: %d, accepted: %d, processed: %d, dropped: %d, processingNumber: %d"
 
 func (it *myItemPipeLine) Summary() string {
 	counts := it.Count()
 	summary := fmt.Sprintf(summaryTemplate,
 		it.failFast, len(it.itemProcesors),
-		counts[0], counts[1], counts[2], it.ProcessingNumber())
+		counts[0], counts[1], counts[2], counts[3], it.ProcessingNumber())
 	return summary
 }
@@ -1,6 +1,13 @@
 package itempipeline
 
-import "webcrawler/base"
+import (
+	"errors"
+	"webcrawler/base"
+)
+
+//条目处理函数返回该错误值(或包装了它的错误值)时,条目会被丢弃,后续的处理函数不再处理它。
+//被丢弃的条目会被单独计数,而不会被当作错误
+var ErrDropItem = errors.New("drop the item")
 
 //被用来处理条目的函数类型
 type ProcessItem func(item base.Item) (result base.Item, err error)
@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"webcrawler/base"
+)
+
+// 创建CSV格式的条目输出。参数columns代表各列所对应的条目的键，
+// 每个新文件的第一行都是由它们组成的表头。条目中缺少的键对应空值，多余的键会被忽略。
+func NewCSVSink(opts FileOptions, columns []string) (Sink, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("The CSV columns can not be empty!")
+	}
+	cs := &csvSink{columns: append([]string(nil), columns...)}
+	header := func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		writer.Write(cs.columns)
+		writer.Flush()
+		return writer.Error()
+	}
+	rf, err := openRotatingFile(opts, header)
+	if err != nil {
+		return nil, err
+	}
+	cs.file = rf
+	return cs, nil
+}
+
+// CSV格式的条目输出的实现类型。
+type csvSink struct {
+	columns []string      // 各列所对应的条目的键。
+	file    *rotatingFile // 文件写入器。
+	written uint64        // 已写入的条目数。
+	mutex   sync.Mutex    // 互斥锁。
+}
+
+func (cs *csvSink) Write(item base.Item) error {
+	record := make([]string, len(cs.columns))
+	for i, column := range cs.columns {
+		value, err := formatValue(item[column])
+		if err != nil {
+			return fmt.Errorf("Can not format the value of column '%s': %s", column, err)
+		}
+		record[i] = value
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if err := cs.file.rotateIfNeeded(); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(cs.file)
+	writer.Write(record)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	cs.written++
+	return nil
+}
+
+// 把值格式化为CSV的单元格。字符串和数值会被直接输出，复合值会被编码为JSON。
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+func (cs *csvSink) Flush() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.file.flush()
+}
+
+func (cs *csvSink) Close() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.file.closeFile()
+}
+
+func (cs *csvSink) Summary() string {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return fmt.Sprintf("format: csv, columns: %d, written: %d, %s", len(cs.columns), cs.written, cs.file.summary())
+}
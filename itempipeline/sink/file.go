@@ -0,0 +1,191 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 文件输出的选项。
+type FileOptions struct {
+	Path     string        // 当前文件的路径。被轮转的文件会在文件名中加上时间戳。
+	MaxSize  int64         // 单个文件在压缩之前的最大字节数，0表示不按大小轮转。
+	Interval time.Duration // 单个文件的最长写入时间，0表示不按时间轮转。
+	Gzip     bool          // 是否使用gzip压缩。
+}
+
+func (opts FileOptions) check() error {
+	if opts.Path == "" {
+		return errors.New("The sink file path can not be empty!")
+	}
+	if opts.MaxSize < 0 {
+		return errors.New("The max size of sink file can not be negative!")
+	}
+	if opts.Interval < 0 {
+		return errors.New("The rotation interval of sink file can not be negative!")
+	}
+	return nil
+}
+
+// 可轮转的文件写入器。它不是并发安全的，由使用它的输出负责加锁。
+type rotatingFile struct {
+	opts     FileOptions             // 选项。
+	file     *os.File                // 当前文件。
+	gzipper  *gzip.Writer            // 压缩写入器，不压缩时为nil。
+	writer   *bufio.Writer           // 缓冲写入器。
+	size     int64                   // 当前文件已写入的字节数。
+	openTime time.Time               // 当前文件的打开时间。
+	rotated  uint64                  // 已轮转的文件数。
+	header   func(w io.Writer) error // 在每个新文件开头写入内容的函数，可能为nil。
+}
+
+// 打开可轮转的文件写入器。不压缩时已存在的文件会被追加写入，压缩时已存在的文件会先被轮转。
+func openRotatingFile(opts FileOptions, header func(w io.Writer) error) (*rotatingFile, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(opts.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	rf := &rotatingFile{opts: opts, header: header}
+	if opts.Gzip {
+		// 已压缩的内容无法换算为压缩之前的字节数，因此先轮转已有的文件，从新的文件开始计算大小。
+		if info, err := os.Stat(opts.Path); err == nil && info.Size() > 0 {
+			if err := os.Rename(opts.Path, rf.rotatedPath()); err != nil {
+				return nil, err
+			}
+			rf.rotated++
+		}
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// 打开当前文件。
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	var w io.Writer = file
+	if rf.opts.Gzip {
+		rf.gzipper = gzip.NewWriter(file)
+		w = rf.gzipper
+	}
+	rf.writer = bufio.NewWriter(w)
+	// 不压缩时已有的内容也计入大小，使得重新打开之后仍然会按大小轮转。
+	// 压缩时打开的总是新的文件，大小从0开始计算。
+	rf.size = info.Size()
+	rf.openTime = time.Now()
+	if info.Size() == 0 && rf.header != nil {
+		if err := rf.header(rf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 写入数据。它实现了io.Writer接口。
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.writer == nil {
+		return 0, errors.New("The sink file is closed!")
+	}
+	n, err := rf.writer.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// 在必要时轮转文件。应在写入一条完整的记录之前调用。
+func (rf *rotatingFile) rotateIfNeeded() error {
+	if rf.writer == nil {
+		return errors.New("The sink file is closed!")
+	}
+	bySize := rf.opts.MaxSize > 0 && rf.size >= rf.opts.MaxSize
+	byTime := rf.opts.Interval > 0 && time.Since(rf.openTime) >= rf.opts.Interval && rf.size > 0
+	if !bySize && !byTime {
+		return nil
+	}
+	if err := rf.closeFile(); err != nil {
+		return err
+	}
+	if err := os.Rename(rf.opts.Path, rf.rotatedPath()); err != nil {
+		return err
+	}
+	rf.rotated++
+	return rf.open()
+}
+
+// 获得被轮转的文件的路径。
+func (rf *rotatingFile) rotatedPath() string {
+	dir, name := filepath.Split(rf.opts.Path)
+	ext := filepath.Ext(name)
+	if ext == ".gz" {
+		ext = filepath.Ext(strings.TrimSuffix(name, ext)) + ext
+	}
+	stem := strings.TrimSuffix(name, ext)
+	stamp := time.Now().Format("20060102T150405")
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", stem, stamp, i, ext))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+}
+
+// 把缓冲的数据写入文件。
+func (rf *rotatingFile) flush() error {
+	if rf.writer == nil {
+		return nil
+	}
+	if err := rf.writer.Flush(); err != nil {
+		return err
+	}
+	if rf.gzipper != nil {
+		return rf.gzipper.Flush()
+	}
+	return nil
+}
+
+// 刷新并关闭当前文件。
+func (rf *rotatingFile) closeFile() error {
+	if rf.writer == nil {
+		return nil
+	}
+	err := rf.writer.Flush()
+	if rf.gzipper != nil {
+		if gzErr := rf.gzipper.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if syncErr := rf.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := rf.file.Close(); err == nil {
+		err = closeErr
+	}
+	rf.writer = nil
+	rf.gzipper = nil
+	rf.file = nil
+	return err
+}
+
+func (rf *rotatingFile) summary() string {
+	return fmt.Sprintf("path: %s, size: %d, rotated: %d, gzip: %v",
+		rf.opts.Path, rf.size, rf.rotated, rf.opts.Gzip)
+}
@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"webcrawler/base"
+)
+
+// 创建JSON Lines格式的条目输出。每个条目占一行。
+func NewJSONLSink(opts FileOptions) (Sink, error) {
+	rf, err := openRotatingFile(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlSink{file: rf}, nil
+}
+
+// JSON Lines格式的条目输出的实现类型。
+type jsonlSink struct {
+	file    *rotatingFile // 文件写入器。
+	written uint64        // 已写入的条目数。
+	mutex   sync.Mutex    // 互斥锁。
+}
+
+func (js *jsonlSink) Write(item base.Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("Can not encode the item to JSON: %s", err)
+	}
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	if err := js.file.rotateIfNeeded(); err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := js.file.Write(data); err != nil {
+		return err
+	}
+	js.written++
+	return nil
+}
+
+func (js *jsonlSink) Flush() error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	return js.file.flush()
+}
+
+func (js *jsonlSink) Close() error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	return js.file.closeFile()
+}
+
+func (js *jsonlSink) Summary() string {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	return fmt.Sprintf("format: jsonl, written: %d, %s", js.written, js.file.summary())
+}
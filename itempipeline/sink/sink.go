@@ -0,0 +1,29 @@
+package sink
+
+import (
+	"webcrawler/base"
+	"webcrawler/itempipeline"
+)
+
+// 条目输出的接口类型。它的实现类型都是并发安全的。
+type Sink interface {
+	// 写入条目。
+	Write(item base.Item) error
+	// 把缓冲的数据写入底层的文件。
+	Flush() error
+	// 刷新并关闭输出。关闭之后的写入会失败。
+	Close() error
+	// 获得摘要信息。
+	Summary() string
+}
+
+// 把条目输出包装为条目处理函数，以便作为条目处理管道中的一级使用。
+// 条目会被原样传递给下一级处理函数。
+func AsProcessor(sink Sink) itempipeline.ProcessItem {
+	return func(item base.Item) (base.Item, error) {
+		if err := sink.Write(item); err != nil {
+			return item, err
+		}
+		return item, nil
+	}
+}
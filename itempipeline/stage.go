@@ -0,0 +1,280 @@
+package itempipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"webcrawler/base"
+)
+
+// 条目处理管道中的一级。
+type Stage struct {
+	Name      string      // 名称。
+	Processor ProcessItem // 处理函数。
+	Workers   uint32      // 并发处理条目的工作协程的数量，0表示1。
+	QueueSize uint32      // 等待处理的条目队列的长度，0表示与工作协程的数量相同。
+}
+
+// 某一级的统计信息。
+type StageStats struct {
+	Name      string        `json:"name"`      // 名称。
+	Workers   uint32        `json:"workers"`   // 工作协程的数量。
+	QueueLen  int           `json:"queueLen"`  // 队列中等待处理的条目数。
+	QueueCap  int           `json:"queueCap"`  // 队列的长度。
+	Processed uint64        `json:"processed"` // 已处理的条目数。
+	Latency   time.Duration `json:"latencyNs"` // 处理条目所花费的总时间。
+}
+
+// 分级的条目处理管道的接口类型。NewStagedItemPipeline返回的管道都实现了它。
+type StagedItemPipeline interface {
+	ItemPipeline
+	// 获得各级的统计信息。
+	Stages() []StageStats
+}
+
+// 在管道中流动的条目。
+type stagedItem struct {
+	item base.Item          // 条目。
+	errs []error            // 处理过程中产生的错误。
+	done func(errs []error) // 处理完毕时调用的函数，可能为nil。
+}
+
+// 正在运行的一级。
+type stageRunner struct {
+	stage     Stage            // 配置。
+	queue     chan *stagedItem // 等待处理的条目队列。
+	next      *stageRunner     // 下一级，最后一级为nil。
+	processed uint64           // 已处理的条目数。
+	latency   uint64           // 处理条目所花费的总时间（纳秒）。
+}
+
+// 创建分级的条目处理管道。
+// 每一级都有自己的工作协程和队列。某一级的队列已满时，上一级会等待，
+// 第一级的队列已满时，发送方会等待，从而把压力传递给发送方。
+func NewStagedItemPipeline(stages []Stage) (ItemPipeline, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("Invalid item stage list!")
+	}
+	pipeline := &stagedItemPipeline{
+		closing:   make(chan struct{}),
+		startTime: time.Now(),
+	}
+	for i, stage := range stages {
+		if stage.Processor == nil {
+			return nil, fmt.Errorf("Invalid item processor of stage [%d]!", i)
+		}
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage-%d", i)
+		}
+		if stage.Workers == 0 {
+			stage.Workers = 1
+		}
+		if stage.QueueSize == 0 {
+			stage.QueueSize = stage.Workers
+		}
+		runner := &stageRunner{stage: stage, queue: make(chan *stagedItem, stage.QueueSize)}
+		if i > 0 {
+			pipeline.stages[i-1].next = runner
+		}
+		pipeline.stages = append(pipeline.stages, runner)
+	}
+	for _, runner := range pipeline.stages {
+		for i := uint32(0); i < runner.stage.Workers; i++ {
+			go pipeline.work(runner)
+		}
+	}
+	return pipeline, nil
+}
+
+// 分级的条目处理管道的实现类型。
+type stagedItemPipeline struct {
+	stages           []*stageRunner // 各级。
+	failFast         uint32         // 是否快速失败，1表示是。
+	send             uint64         // 已发送条目的数量。
+	accepted         uint64         // 已接受数量。
+	processed        uint64         // 已处理条目数量。
+	dropped          uint64         // 已丢弃条目数量。
+	processingNumber uint64         // 处理中数量。
+	closing          chan struct{}  // 关闭时被关闭。
+	closeOnce        sync.Once      // 保证只关闭一次。
+	startTime        time.Time      // 创建的时间。
+}
+
+// 工作协程的主循环。
+func (pipeline *stagedItemPipeline) work(runner *stageRunner) {
+	for {
+		select {
+		case <-pipeline.closing:
+			return
+		case si := <-runner.queue:
+			if !pipeline.process(runner, si) {
+				return
+			}
+		}
+	}
+}
+
+// 在某一级处理条目，并把它交给下一级。若管道已被关闭，则返回false。
+func (pipeline *stagedItemPipeline) process(runner *stageRunner, si *stagedItem) bool {
+	start := time.Now()
+	result, err := runner.call(si.item)
+	atomic.AddUint64(&runner.latency, uint64(time.Since(start)))
+	atomic.AddUint64(&runner.processed, 1)
+	if errors.Is(err, ErrDropItem) {
+		atomic.AddUint64(&pipeline.dropped, 1)
+		pipeline.finish(si)
+		return true
+	}
+	if err != nil {
+		si.errs = append(si.errs, err)
+		if pipeline.FailFast() {
+			atomic.AddUint64(&pipeline.processed, 1)
+			pipeline.finish(si)
+			return true
+		}
+	}
+	if result != nil {
+		si.item = result
+	}
+	if runner.next == nil {
+		atomic.AddUint64(&pipeline.processed, 1)
+		pipeline.finish(si)
+		return true
+	}
+	select {
+	case runner.next.queue <- si:
+		return true
+	case <-pipeline.closing:
+		return false
+	}
+}
+
+// 调用处理函数。处理函数引发的运行时恐慌会被转换为错误，以免工作协程退出。
+func (runner *stageRunner) call(item base.Item) (result base.Item, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("Fatal item processing error in stage '%s': %v", runner.stage.Name, p)
+		}
+	}()
+	return runner.stage.Processor(item)
+}
+
+// 结束条目的处理。
+func (pipeline *stagedItemPipeline) finish(si *stagedItem) {
+	atomic.AddUint64(&pipeline.processingNumber, ^uint64(0))
+	if si.done != nil {
+		si.done(si.errs)
+	}
+}
+
+func (pipeline *stagedItemPipeline) Send(item base.Item) []error {
+	result := make(chan []error, 1)
+	err := pipeline.SendAsync(item, func(errs []error) {
+		result <- errs
+	})
+	if err != nil {
+		return []error{err}
+	}
+	return <-result
+}
+
+func (pipeline *stagedItemPipeline) SendAsync(item base.Item, done func(errs []error)) error {
+	select {
+	case <-pipeline.closing:
+		return errors.New("The item pipeline is closed!")
+	default:
+	}
+	atomic.AddUint64(&pipeline.send, 1)
+	if item == nil {
+		if done != nil {
+			done([]error{errors.New("The item is invalid!")})
+		}
+		return nil
+	}
+	atomic.AddUint64(&pipeline.accepted, 1)
+	atomic.AddUint64(&pipeline.processingNumber, 1)
+	si := &stagedItem{item: item, errs: make([]error, 0), done: done}
+	select {
+	case pipeline.stages[0].queue <- si:
+		return nil
+	case <-pipeline.closing:
+		atomic.AddUint64(&pipeline.processingNumber, ^uint64(0))
+		return errors.New("The item pipeline is closed!")
+	}
+}
+
+func (pipeline *stagedItemPipeline) Close() {
+	pipeline.closeOnce.Do(func() {
+		close(pipeline.closing)
+	})
+}
+
+func (pipeline *stagedItemPipeline) FailFast() bool {
+	return atomic.LoadUint32(&pipeline.failFast) == 1
+}
+
+func (pipeline *stagedItemPipeline) SetFailFast(failFast bool) {
+	var value uint32
+	if failFast {
+		value = 1
+	}
+	atomic.StoreUint32(&pipeline.failFast, value)
+}
+
+func (pipeline *stagedItemPipeline) Count() []uint64 {
+	counts := make([]uint64, 4)
+	counts[0] = atomic.LoadUint64(&pipeline.send)
+	counts[1] = atomic.LoadUint64(&pipeline.accepted)
+	counts[2] = atomic.LoadUint64(&pipeline.processed)
+	counts[3] = atomic.LoadUint64(&pipeline.dropped)
+	return counts
+}
+
+func (pipeline *stagedItemPipeline) ProcessingNumber() uint64 {
+	return atomic.LoadUint64(&pipeline.processingNumber)
+}
+
+// 单级摘要信息的模板。
+var stageSummaryTemplate = "%s: { workers: %d, queue: %d/%d, processed: %d," +
+	" avgLatency: %s, throughput: %.2f/s }"
+
+func (pipeline *stagedItemPipeline) Stages() []StageStats {
+	stats := make([]StageStats, 0, len(pipeline.stages))
+	for _, runner := range pipeline.stages {
+		stats = append(stats, StageStats{
+			Name:      runner.stage.Name,
+			Workers:   runner.stage.Workers,
+			QueueLen:  len(runner.queue),
+			QueueCap:  cap(runner.queue),
+			Processed: atomic.LoadUint64(&runner.processed),
+			Latency:   time.Duration(atomic.LoadUint64(&runner.latency)),
+		})
+	}
+	return stats
+}
+
+func (pipeline *stagedItemPipeline) Summary() string {
+	counts := pipeline.Count()
+	summary := fmt.Sprintf(summaryTemplate,
+		pipeline.FailFast(), len(pipeline.stages),
+		counts[0], counts[1], counts[2], counts[3], pipeline.ProcessingNumber())
+	elapsed := time.Since(pipeline.startTime).Seconds()
+	stages := make([]string, 0, len(pipeline.stages))
+	for _, stat := range pipeline.Stages() {
+		var avgLatency time.Duration
+		if stat.Processed > 0 {
+			avgLatency = stat.Latency / time.Duration(stat.Processed)
+		}
+		var throughput float64
+		if elapsed > 0 {
+			throughput = float64(stat.Processed) / elapsed
+		}
+		stages = append(stages, fmt.Sprintf(stageSummaryTemplate,
+			stat.Name, stat.Workers, stat.QueueLen, stat.QueueCap,
+			stat.Processed, avgLatency, throughput))
+	}
+	return fmt.Sprintf("%s, stages: [%s]", summary, strings.Join(stages, ", "))
+}
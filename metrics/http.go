@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+)
+
+// 指标的路径。
+const METRICS_PATH = "/metrics"
+
+// Prometheus文本格式的内容类型。
+const textContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 以Prometheus文本格式响应全部指标。它实现了http.Handler接口。
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var buffer bytes.Buffer
+	if err := r.WriteText(&buffer); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", textContentType)
+	w.Write(buffer.Bytes())
+}
+
+// 在参数addr所代表的本地地址上监听，并在METRICS_PATH上提供指标。
+// 地址必须是回环地址，例如"127.0.0.1:9090"。关闭结果值即可停止监听。
+func (r *Registry) Listen(addr string) (io.Closer, error) {
+	if addr == "" {
+		return nil, errors.New("The metrics listen address can not be empty!")
+	}
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+	return r.listen(addr)
+}
+
+// 与Listen相同，但允许任意地址，例如":9090"（所有网络接口）。
+// 指标接口没有访问控制，只有在确实需要从其他机器抓取指标时才应使用它。
+func (r *Registry) ListenPublic(addr string) (io.Closer, error) {
+	if addr == "" {
+		return nil, errors.New("The metrics listen address can not be empty!")
+	}
+	return r.listen(addr)
+}
+
+// 检查监听地址是否为回环地址。
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("Invalid metrics address '%s': %s", addr, err)
+	}
+	if strings.EqualFold(host, "localhost") {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("The metrics address '%s' is not a loopback address! Use ListenPublic instead.", addr)
+}
+
+// 在参数addr所代表的地址上监听。
+func (r *Registry) listen(addr string) (io.Closer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_PATH, r)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			golog.Errorf("Occur error when serve metrics: %s\n", err)
+		}
+	}()
+	golog.Infof("Serving metrics at http://%s%s\n", listener.Addr(), METRICS_PATH)
+	return &metricsServer{server: server}, nil
+}
+
+// 指标服务。
+type metricsServer struct {
+	server *http.Server
+}
+
+func (ms *metricsServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return ms.server.Shutdown(ctx)
+}
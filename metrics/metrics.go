@@ -0,0 +1,367 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 默认的直方图桶的上界，单位：秒。
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 指标收集器的接口类型。它的实现类型都是并发安全的。
+type Collector interface {
+	// 获得指标的名称。
+	Name() string
+	// 以Prometheus文本格式写出指标，包括HELP和TYPE行。
+	Write(w io.Writer) error
+}
+
+// 指标的描述。
+type desc struct {
+	name       string   // 名称。
+	help       string   // 说明。
+	typ        string   // 类型，counter、gauge或histogram。
+	labelNames []string // 标签名称。
+}
+
+func newDesc(name, help, typ string, labelNames []string) desc {
+	if !validName(name) {
+		panic(fmt.Errorf("Invalid metric name '%s'!", name))
+	}
+	for _, label := range labelNames {
+		if !validName(label) || strings.HasPrefix(label, "__") || label == "le" {
+			panic(fmt.Errorf("Invalid label name '%s' of metric '%s'!", label, name))
+		}
+	}
+	return desc{name: name, help: help, typ: typ, labelNames: append([]string(nil), labelNames...)}
+}
+
+func (d *desc) Name() string {
+	return d.name
+}
+
+// 写出HELP和TYPE行。
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// 检查标签值的数量，并生成用作序列键的字符串。
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Errorf("The metric '%s' expects %d label values, got %d!",
+			d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// 写出一个样本。参数extra是附加的标签，例如直方图的le。
+func (d *desc) writeSample(w *bufio.Writer, suffix string, labelValues []string,
+	extraName string, extraValue string, value float64) {
+	w.WriteString(d.name)
+	w.WriteString(suffix)
+	if len(labelValues) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, name := range d.labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", name, escapeLabel(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labelValues) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// 计数器。它的值只增不减。
+type Counter struct {
+	desc
+	values map[string]*counterSeries // 各序列，以标签值为键。
+	mutex  sync.Mutex                // 互斥锁。
+}
+
+// 计数器中的一个序列。
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// 创建计数器。参数labelNames代表标签名称。
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{
+		desc:   newDesc(name, help, "counter", labelNames),
+		values: make(map[string]*counterSeries),
+	}
+}
+
+// 把与标签值对应的序列加1。
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// 把与标签值对应的序列加上delta。参数delta不能为负数。
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Errorf("The counter '%s' can not decrease!", c.name))
+	}
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	series, ok := c.values[key]
+	if !ok {
+		series = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = series
+	}
+	series.value += delta
+}
+
+// 获得与标签值对应的序列的值。
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if series, ok := c.values[key]; ok {
+		return series.value
+	}
+	return 0
+}
+
+func (c *Counter) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.writeHeader(bw)
+	c.mutex.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		series := c.values[key]
+		c.writeSample(bw, "", series.labelValues, "", "", series.value)
+	}
+	c.mutex.Unlock()
+	return bw.Flush()
+}
+
+// 直方图。
+type Histogram struct {
+	desc
+	buckets []float64                   // 桶的上界，升序，不包含+Inf。
+	series  map[string]*histogramSeries // 各序列，以标签值为键。
+	mutex   sync.Mutex                  // 互斥锁。
+}
+
+// 直方图中的一个序列。
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // 各桶的计数，不累加。
+	count       uint64   // 样本总数。
+	sum         float64  // 样本之和。
+}
+
+// 创建直方图。若参数buckets为空则使用DefBuckets。
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	if math.IsInf(sorted[len(sorted)-1], 1) {
+		sorted = sorted[:len(sorted)-1]
+	}
+	return &Histogram{
+		desc:    newDesc(name, help, "histogram", labelNames),
+		buckets: sorted,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// 记录一个样本。
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = series
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		series.counts[i]++
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *Histogram) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	h.writeHeader(bw)
+	h.mutex.Lock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		series := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += series.counts[i]
+			h.writeSample(bw, "_bucket", series.labelValues, "le", formatFloat(upper), float64(cumulative))
+		}
+		h.writeSample(bw, "_bucket", series.labelValues, "le", "+Inf", float64(series.count))
+		h.writeSample(bw, "_sum", series.labelValues, "", "", series.sum)
+		h.writeSample(bw, "_count", series.labelValues, "", "", float64(series.count))
+	}
+	h.mutex.Unlock()
+	return bw.Flush()
+}
+
+// 在收集时才获得的样本。
+type Sample struct {
+	LabelValues []string // 标签值，顺序与标签名称相同。
+	Value       float64  // 值。
+}
+
+// 在收集时调用函数获得样本的指标。
+type funcCollector struct {
+	desc
+	collect func() []Sample // 获得样本的函数。
+}
+
+// 创建在收集时调用参数collect获得样本的计量器。它适用于池的使用量之类的瞬时值。
+func NewGaugeFunc(name, help string, labelNames []string, collect func() []Sample) Collector {
+	return &funcCollector{desc: newDesc(name, help, "gauge", labelNames), collect: collect}
+}
+
+// 创建在收集时调用参数collect获得样本的计数器。它适用于由其他组件维护的只增不减的计数值。
+func NewCounterFunc(name, help string, labelNames []string, collect func() []Sample) Collector {
+	return &funcCollector{desc: newDesc(name, help, "counter", labelNames), collect: collect}
+}
+
+func (fc *funcCollector) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fc.writeHeader(bw)
+	for _, sample := range fc.collect() {
+		fc.key(sample.LabelValues)
+		fc.writeSample(bw, "", sample.LabelValues, "", "", sample.Value)
+	}
+	return bw.Flush()
+}
+
+// 指标的注册表。
+type Registry struct {
+	collectors map[string]Collector // 已注册的收集器，以名称为键。
+	mutex      sync.RWMutex         // 读写锁。
+}
+
+// 创建指标的注册表。
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// 注册收集器。名称相同的收集器只能注册一次。
+func (r *Registry) Register(collectors ...Collector) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, c := range collectors {
+		if c == nil {
+			return errors.New("The metric collector is invalid!")
+		}
+		if _, ok := r.collectors[c.Name()]; ok {
+			return fmt.Errorf("The metric '%s' is already registered!", c.Name())
+		}
+	}
+	for _, c := range collectors {
+		r.collectors[c.Name()] = c
+	}
+	return nil
+}
+
+// 注销收集器。
+func (r *Registry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.collectors, name)
+}
+
+// 按照名称的顺序以Prometheus文本格式写出全部指标。
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	for _, name := range sortKeys(names) {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mutex.RUnlock()
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 对键进行排序，使得输出的顺序稳定。
+func sortKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -86,7 +86,7 @@ func (pool *myPool) Return(entity Entity) error {
 	return nil
 }
 //结果值 -1表示键值不存在,0表示失败 1表示成功
-func (pool *myPool) compareAndSetForIdContainer(entityId uint32, oldValue bool, newValue bool) uint8 {
+func (pool *myPool) compareAndSetForIdContainer(entityId uint32, oldValue bool, newValue bool) int8 {
 	pool.mutex.Lock()
 	defer pool.mutex.Unlock()
 	v, ok := pool.idContainer[entityId]
@@ -19,6 +19,8 @@ type StopSign interface {
 	DealCount(code string) uint32
 	//获取停止信号被处理的总计数
 	DealTotal() uint32
+	//获得所有停止信号处理方的处理计数,结果值是一个副本
+	DealCounts() map[string]uint32
 	//获取摘要信息,其中应该包含所有的停止信号处理记录
 	Summary() string
 }
@@ -86,6 +88,16 @@ func (ss *myStopSign) DealTotal() uint32 {
 	return total
 }
 
+func (ss *myStopSign) DealCounts() map[string]uint32 {
+	ss.rwmutex.Lock()
+	defer ss.rwmutex.Unlock()
+	counts := make(map[string]uint32, len(ss.dealCountMap))
+	for k, v := range ss.dealCountMap {
+		counts[k] = v
+	}
+	return counts
+}
+
 func (ss *myStopSign) Summary() string {
 	if ss.signed {
 		return fmt.Sprintf("signed: true, dealCount: %v", ss.dealCountMap)
@@ -0,0 +1,201 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robots.txt文件被读取的最大字节数。
+const MaxSize = 500 * 1024
+
+// 已解析的robots.txt。
+type Robots struct {
+	groups   []*Group // 规则组。
+	Sitemaps []string // 其中声明的Sitemap的URL。
+}
+
+// 适用于一组用户代理的规则组。
+type Group struct {
+	agents     []string      // 用户代理。
+	rules      []rule        // 规则。
+	crawlDelay time.Duration // 抓取间隔。
+	hasDelay   bool          // 是否指定了抓取间隔。
+}
+
+// 单条Allow或Disallow规则。
+type rule struct {
+	allow   bool   // 是否为Allow规则。
+	pattern string // 路径模式，其中可以包含“*”和结尾的“$”。
+}
+
+// 允许一切的规则组。
+var allowAll = &Group{}
+
+// 禁止一切的规则组。
+var disallowAll = &Group{rules: []rule{{allow: false, pattern: "/"}}}
+
+// 创建允许一切的robots.txt，适用于robots.txt不存在的情况。
+func AllowAll() *Robots {
+	return &Robots{groups: []*Group{{agents: []string{"*"}}}}
+}
+
+// 创建禁止一切的robots.txt，适用于robots.txt暂时无法获取的情况。
+func DisallowAll() *Robots {
+	return &Robots{groups: []*Group{{agents: []string{"*"}, rules: disallowAll.rules}}}
+}
+
+// 根据robots.txt的HTTP状态码和内容生成结果。
+// 2xx时解析内容；4xx时视为允许一切；其他情况视为禁止一切。
+func FromResponse(statusCode int, body io.Reader) *Robots {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return Parse(body)
+	case statusCode >= 400 && statusCode < 500:
+		return AllowAll()
+	default:
+		return DisallowAll()
+	}
+}
+
+// 解析robots.txt的内容。无法识别的行会被忽略。
+func Parse(body io.Reader) *Robots {
+	robots := &Robots{}
+	var current *Group
+	// 上一行是否为User-agent行。连续的User-agent行属于同一个规则组。
+	lastWasAgent := false
+	scanner := bufio.NewScanner(io.LimitReader(body, MaxSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		index := strings.Index(line, ":")
+		if index < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:index]))
+		value := strings.TrimSpace(line[index+1:])
+		switch key {
+		case "user-agent":
+			if current == nil || !lastWasAgent {
+				current = &Group{}
+				robots.groups = append(robots.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			if current != nil && value != "" {
+				current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+					current.crawlDelay = time.Duration(seconds * float64(time.Second))
+					current.hasDelay = true
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+		}
+		lastWasAgent = false
+	}
+	return robots
+}
+
+// 获得适用于某个用户代理的规则组。
+// 名称被用户代理包含的规则组中名称最长的那个胜出；若没有，则使用“*”规则组。
+// 若两者都不存在，则返回允许一切的规则组。
+func (robots *Robots) Group(userAgent string) *Group {
+	userAgent = strings.ToLower(userAgent)
+	var matched *Group
+	var matchedLen int
+	var wildcard *Group
+	for _, group := range robots.groups {
+		for _, agent := range group.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = group
+				}
+				continue
+			}
+			if agent != "" && strings.Contains(userAgent, agent) && len(agent) > matchedLen {
+				matched = group
+				matchedLen = len(agent)
+			}
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return allowAll
+}
+
+// 判断规则组是否允许访问某个URL。
+// 匹配的规则中模式最长的那个胜出；长度相同时Allow规则胜出。
+func (group *Group) Allowed(reqUrl *url.URL) bool {
+	path := reqUrl.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if reqUrl.RawQuery != "" {
+		path += "?" + reqUrl.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed := true
+	bestLen := -1
+	for _, r := range group.rules {
+		if !match(r.pattern, path) {
+			continue
+		}
+		if len(r.pattern) > bestLen || (len(r.pattern) == bestLen && r.allow) {
+			allowed = r.allow
+			bestLen = len(r.pattern)
+		}
+	}
+	return allowed
+}
+
+// 获得规则组的抓取间隔。若未指定，则第二个结果值为false。
+func (group *Group) CrawlDelay() (time.Duration, bool) {
+	return group.crawlDelay, group.hasDelay
+}
+
+// 判断路径是否匹配模式。模式中的“*”匹配任意字符序列，结尾的“$”匹配路径的结尾。
+func match(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if i == len(parts)-1 && anchored {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		index := strings.Index(path[pos:], part)
+		if index < 0 {
+			return false
+		}
+		pos += index + len(part)
+	}
+	if anchored {
+		return pos == len(path)
+	}
+	return true
+}
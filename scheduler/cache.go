@@ -18,6 +18,10 @@ type requestCache interface {
 	put(req *base.Request) bool
 	// 从请求缓存获取最早被放入且仍在其中的请求。
 	get() *base.Request
+	// 通知请求缓存：某个之前被取出的请求已被处理完毕。
+	done(req *base.Request)
+	// 取出请求缓存中剩余的所有请求，不考虑礼貌限制和重试时间等调度条件。
+	drain() []*base.Request
 	// 获得请求缓存的容量。
 	capacity() int
 	// 获得请求缓存的实时长度，即：其中的请求的即时数量。
@@ -26,6 +30,10 @@ type requestCache interface {
 	close()
 	// 获取请求缓存的摘要信息。
 	summary() string
+	// 获取请求缓存的统计信息。
+	stats() ReqCacheSnapshot
+	// 按照大致的调度顺序列出其中的请求，但不取出它们。参数limit为0时表示不限数量。
+	list(limit int) []*base.Request
 }
 
 // 创建请求缓存。
@@ -70,6 +78,28 @@ func (rcache *reqCacheBySlice) get() *base.Request {
 	return req
 }
 
+func (rcache *reqCacheBySlice) done(req *base.Request) {}
+
+func (rcache *reqCacheBySlice) drain() []*base.Request {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	reqs := rcache.cache
+	rcache.cache = make([]*base.Request, 0)
+	return reqs
+}
+
+func (rcache *reqCacheBySlice) list(limit int) []*base.Request {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	n := len(rcache.cache)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	reqs := make([]*base.Request, n)
+	copy(reqs, rcache.cache)
+	return reqs
+}
+
 func (rcache *reqCacheBySlice) capacity() int {
 	return cap(rcache.cache)
 }
@@ -88,6 +118,17 @@ func (rcache *reqCacheBySlice) close() {
 // 摘要信息模板。
 var summaryTemplate = "status: %s, " + "length: %d, " + "capacity: %d"
 
+func (rcache *reqCacheBySlice) stats() ReqCacheSnapshot {
+	rcache.mutex.Lock()
+	status := rcache.status
+	rcache.mutex.Unlock()
+	return ReqCacheSnapshot{
+		Status:   statusMap[status],
+		Length:   rcache.length(),
+		Capacity: rcache.capacity(),
+	}
+}
+
 func (rcache *reqCacheBySlice) summary() string {
 	summary := fmt.Sprintf(summaryTemplate,
 		statusMap[rcache.status],
@@ -0,0 +1,408 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"webcrawler/analyzer"
+	"webcrawler/base"
+	"webcrawler/deadletter"
+	"webcrawler/itempipeline"
+	"webcrawler/metrics"
+)
+
+// 默认的通道长度。
+const DEFAULT_CHANNEL_LEN = 10
+
+// 默认的网页下载器池和分析器池的尺寸。
+const DEFAULT_POOL_SIZE = 3
+
+// 事件监听器的配置。
+type ListenerConfig struct {
+	Listener Listener    // 监听器。
+	Buffer   int         // 缓冲区的长度，0表示DEFAULT_EVENT_BUFFER。
+	Types    []EventType // 关注的事件类型，为空表示全部。
+}
+
+// 调度器的配置。它实现了base.Args接口。
+// 除了Start的各个参数之外，它还包含了只能在调度器启动之前设置的各项功能，
+// 值为零值的字段代表不启用相应的功能。
+type Config struct {
+	ChannelArgs         base.ChannelArgs           // 通道参数。
+	PoolBaseArgs        base.PoolBaseArgs          // 池基本参数。
+	CrawlDepth          uint32                     // 爬取的最大深度。
+	Seeds               []*http.Request            // 种子请求，至少要有一个。
+	Scope               ScopePolicy                // 爬取范围策略，为nil表示只爬取与种子请求处于同一主域名下的网页。
+	SchemePolicy        SchemePolicy               // URL协议策略，为nil表示只允许http和https。
+	HttpClientGenerator GenHttpClient              // 生成HTTP客户端的函数。
+	RespParsers         []analyzer.ParseResponse   // 响应解析函数的列表，它们会处理每一个响应。
+	Router              analyzer.Router            // 解析函数路由器，它会在RespParsers之后处理响应。
+	ItemProcessors      []itempipeline.ProcessItem // 条目处理函数的列表，设置了ItemStages时必须为空。
+	ItemStages          []itempipeline.Stage       // 分级的条目处理管道的各级。
+	Politeness          *base.PolitenessArgs       // 礼貌参数。
+	Retry               *base.RetryArgs            // 重试参数。
+	RobotsUserAgent     string                     // 遵守robots.txt时使用的用户代理。
+	FrontierStrategy    *FrontierStrategy          // 请求缓存的调度策略。
+	DataDir             string                     // 持久化数据目录。
+	JobID               string                     // 作业ID，设置了DataDir时不能为空。
+	DeadLetter          deadletter.Store           // 死信存储。
+	Metrics             *metrics.Registry          // 指标注册表。
+	Listeners           []ListenerConfig           // 事件监听器。
+	Closers             []io.Closer                // 调度器关闭时需要被关闭的资源。
+	description         string                     // 描述。
+}
+
+// 调度器的配置项。
+type Option func(cfg *Config)
+
+// 创建调度器的配置。未被配置项设置的通道长度和池尺寸会使用默认值，
+// 默认的HTTP客户端生成函数会返回零值的http.Client。
+func NewConfig(opts ...Option) Config {
+	cfg := Config{
+		ChannelArgs: base.NewChannelArgs(DEFAULT_CHANNEL_LEN, DEFAULT_CHANNEL_LEN,
+			DEFAULT_CHANNEL_LEN, DEFAULT_CHANNEL_LEN),
+		PoolBaseArgs: base.NewPoolBaseArgs(DEFAULT_POOL_SIZE, DEFAULT_POOL_SIZE),
+		HttpClientGenerator: func() *http.Client {
+			return &http.Client{}
+		},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
+
+// 设置通道参数。
+func WithChannelArgs(args base.ChannelArgs) Option {
+	return func(cfg *Config) {
+		cfg.ChannelArgs = args
+	}
+}
+
+// 设置池基本参数。
+func WithPoolBaseArgs(args base.PoolBaseArgs) Option {
+	return func(cfg *Config) {
+		cfg.PoolBaseArgs = args
+	}
+}
+
+// 设置爬取的最大深度。
+func WithCrawlDepth(depth uint32) Option {
+	return func(cfg *Config) {
+		cfg.CrawlDepth = depth
+	}
+}
+
+// 添加种子请求。
+func WithSeeds(httpReqs ...*http.Request) Option {
+	return func(cfg *Config) {
+		cfg.Seeds = append(cfg.Seeds, httpReqs...)
+	}
+}
+
+// 设置爬取范围策略。
+func WithScope(scope ScopePolicy) Option {
+	return func(cfg *Config) {
+		cfg.Scope = scope
+	}
+}
+
+// 设置URL协议策略。
+func WithSchemePolicy(policy SchemePolicy) Option {
+	return func(cfg *Config) {
+		cfg.SchemePolicy = policy
+	}
+}
+
+// 设置生成HTTP客户端的函数。
+func WithHttpClientGenerator(generator GenHttpClient) Option {
+	return func(cfg *Config) {
+		cfg.HttpClientGenerator = generator
+	}
+}
+
+// 添加响应解析函数。
+func WithRespParsers(parsers ...analyzer.ParseResponse) Option {
+	return func(cfg *Config) {
+		cfg.RespParsers = append(cfg.RespParsers, parsers...)
+	}
+}
+
+// 设置解析函数路由器。
+func WithRouter(router analyzer.Router) Option {
+	return func(cfg *Config) {
+		cfg.Router = router
+	}
+}
+
+// 添加条目处理函数。
+func WithItemProcessors(processors ...itempipeline.ProcessItem) Option {
+	return func(cfg *Config) {
+		cfg.ItemProcessors = append(cfg.ItemProcessors, processors...)
+	}
+}
+
+// 添加分级的条目处理管道的各级。
+func WithItemStages(stages ...itempipeline.Stage) Option {
+	return func(cfg *Config) {
+		cfg.ItemStages = append(cfg.ItemStages, stages...)
+	}
+}
+
+// 设置礼貌参数。
+func WithPoliteness(args base.PolitenessArgs) Option {
+	return func(cfg *Config) {
+		cfg.Politeness = &args
+	}
+}
+
+// 设置重试参数。
+func WithRetry(args base.RetryArgs) Option {
+	return func(cfg *Config) {
+		cfg.Retry = &args
+	}
+}
+
+// 设置遵守robots.txt时使用的用户代理。
+func WithRobots(userAgent string) Option {
+	return func(cfg *Config) {
+		cfg.RobotsUserAgent = userAgent
+	}
+}
+
+// 设置请求缓存的调度策略。
+func WithFrontierStrategy(strategy *FrontierStrategy) Option {
+	return func(cfg *Config) {
+		cfg.FrontierStrategy = strategy
+	}
+}
+
+// 设置持久化参数。
+func WithPersistence(dataDir string, jobID string) Option {
+	return func(cfg *Config) {
+		cfg.DataDir = dataDir
+		cfg.JobID = jobID
+	}
+}
+
+// 设置死信存储。
+func WithDeadLetter(store deadletter.Store) Option {
+	return func(cfg *Config) {
+		cfg.DeadLetter = store
+	}
+}
+
+// 设置指标注册表。
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(cfg *Config) {
+		cfg.Metrics = registry
+	}
+}
+
+// 添加事件监听器。
+func WithListener(listener Listener, buffer int, types ...EventType) Option {
+	return func(cfg *Config) {
+		cfg.Listeners = append(cfg.Listeners, ListenerConfig{Listener: listener, Buffer: buffer, Types: types})
+	}
+}
+
+// 添加调度器关闭时需要被关闭的资源。
+func WithClosers(closers ...io.Closer) Option {
+	return func(cfg *Config) {
+		cfg.Closers = append(cfg.Closers, closers...)
+	}
+}
+
+func (cfg *Config) Check() error {
+	if err := cfg.ChannelArgs.Check(); err != nil {
+		return err
+	}
+	if err := cfg.PoolBaseArgs.Check(); err != nil {
+		return err
+	}
+	if len(cfg.Seeds) == 0 {
+		return errors.New("The seed request list can not be empty!\n")
+	}
+	for i, seed := range cfg.Seeds {
+		if seed == nil || seed.URL == nil {
+			return fmt.Errorf("The %dth seed request is invalid!\n", i)
+		}
+	}
+	if cfg.HttpClientGenerator == nil {
+		return errors.New("The HTTP client generator is invalid!\n")
+	}
+	for i, parser := range cfg.RespParsers {
+		if parser == nil {
+			return fmt.Errorf("The %dth response parser is invalid!\n", i)
+		}
+	}
+	if len(cfg.ItemStages) > 0 {
+		if len(cfg.ItemProcessors) > 0 {
+			return errors.New("The item processor list must be empty when item stages are set!\n")
+		}
+		for i, stage := range cfg.ItemStages {
+			if stage.Processor == nil {
+				return fmt.Errorf("The item processor of stage [%d] is invalid!\n", i)
+			}
+		}
+	} else {
+		if cfg.ItemProcessors == nil {
+			return errors.New("The item processor list is invalid!\n")
+		}
+		for i, ip := range cfg.ItemProcessors {
+			if ip == nil {
+				return fmt.Errorf("The %dth item processor is invalid!\n", i)
+			}
+		}
+	}
+	if cfg.Politeness != nil {
+		if err := cfg.Politeness.Check(); err != nil {
+			return err
+		}
+	}
+	if cfg.Retry != nil {
+		if err := cfg.Retry.Check(); err != nil {
+			return err
+		}
+	}
+	if cfg.DataDir != "" && cfg.JobID == "" {
+		return errors.New("The job ID can not be empty!\n")
+	}
+	for i, lc := range cfg.Listeners {
+		if lc.Listener == nil {
+			return fmt.Errorf("The %dth event listener is invalid!\n", i)
+		}
+		if lc.Buffer < 0 {
+			return fmt.Errorf("Invalid event buffer size %d of the %dth event listener!\n", lc.Buffer, i)
+		}
+	}
+	for i, closer := range cfg.Closers {
+		if closer == nil {
+			return fmt.Errorf("The %dth closer is invalid!\n", i)
+		}
+	}
+	return nil
+}
+
+// 调度器配置的描述模板。
+var configTemplate string = "{ channelArgs: %s, poolBaseArgs: %s, crawlDepth: %d, seeds: [%s]," +
+	" scope: %v, respParsers: %d, itemProcessors: %d, itemStages: %d, politeness: %v, retry: %v," +
+	" robots: %q, persistence: %q, listeners: %d }"
+
+func (cfg *Config) String() string {
+	if cfg.description == "" {
+		seeds := make([]string, 0, len(cfg.Seeds))
+		for _, seed := range cfg.Seeds {
+			if seed != nil && seed.URL != nil {
+				seeds = append(seeds, seed.URL.String())
+			}
+		}
+		var politeness, retry interface{} = "<disabled>", "<disabled>"
+		if cfg.Politeness != nil {
+			politeness = cfg.Politeness.String()
+		}
+		if cfg.Retry != nil {
+			retry = cfg.Retry.String()
+		}
+		var persistence string
+		if cfg.DataDir != "" {
+			persistence = jobDir(cfg.DataDir, cfg.JobID)
+		}
+		cfg.description =
+			fmt.Sprintf(configTemplate,
+				cfg.ChannelArgs.String(),
+				cfg.PoolBaseArgs.String(),
+				cfg.CrawlDepth,
+				strings.Join(seeds, ", "),
+				cfg.Scope,
+				len(cfg.RespParsers),
+				len(cfg.ItemProcessors),
+				len(cfg.ItemStages),
+				politeness,
+				retry,
+				cfg.RobotsUserAgent,
+				persistence,
+				len(cfg.Listeners))
+	}
+	return cfg.description
+}
+
+// 把只能在启动之前设置的各项功能应用到调度器上。
+func (cfg *Config) apply(sched *myScheduler) error {
+	if err := sched.SetSchemePolicy(cfg.SchemePolicy); err != nil {
+		return err
+	}
+	if err := sched.SetPersistence(cfg.DataDir, cfg.JobID); err != nil {
+		return err
+	}
+	if err := sched.SetFrontierStrategy(cfg.FrontierStrategy); err != nil {
+		return err
+	}
+	if cfg.Politeness != nil {
+		if err := sched.SetPoliteness(*cfg.Politeness); err != nil {
+			return err
+		}
+	}
+	if err := sched.SetRobots(cfg.RobotsUserAgent); err != nil {
+		return err
+	}
+	if err := sched.SetRetry(cfg.Retry); err != nil {
+		return err
+	}
+	if err := sched.SetRouter(cfg.Router); err != nil {
+		return err
+	}
+	if err := sched.SetItemStages(cfg.ItemStages); err != nil {
+		return err
+	}
+	if err := sched.SetDeadLetter(cfg.DeadLetter); err != nil {
+		return err
+	}
+	if err := sched.SetMetrics(cfg.Metrics); err != nil {
+		return err
+	}
+	for _, lc := range cfg.Listeners {
+		if err := sched.AddListener(lc.Listener, lc.Buffer, lc.Types...); err != nil {
+			return err
+		}
+	}
+	for _, closer := range cfg.Closers {
+		sched.RegisterCloser(closer)
+	}
+	return nil
+}
+
+// 根据配置创建调度器。配置会在创建时被检查，调度器需要通过Run启动。
+func NewSchedulerWithConfig(cfg Config) (Scheduler, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	cfg.Seeds = append([]*http.Request(nil), cfg.Seeds...)
+	sched := &myScheduler{schemePolicy: NewSchemePolicy(false)}
+	if err := cfg.apply(sched); err != nil {
+		return nil, err
+	}
+	sched.config = &cfg
+	return sched, nil
+}
+
+// 根据配置项创建调度器。它等同于NewSchedulerWithConfig(NewConfig(opts...))。
+func NewSchedulerWithOptions(opts ...Option) (Scheduler, error) {
+	return NewSchedulerWithConfig(NewConfig(opts...))
+}
+
+func (sched *myScheduler) Run(ctx context.Context) error {
+	if sched.config == nil {
+		return errors.New("The scheduler was not created with a config! Use Start instead.\n")
+	}
+	// 创建之后仍然可以通过SetItemStages和SetRouter修改条目处理管道的各级和解析函数路由器。
+	cfg := *sched.config
+	cfg.ItemStages = sched.itemStages
+	cfg.Router = sched.router
+	return sched.start(ctx, &cfg)
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"webcrawler/base"
+
+	"github.com/kataras/golog"
+)
+
+// 保留的最近错误的数量。
+const recentErrorCapacity = 100
+
+// 最近错误的环形缓冲区。
+type errorRing struct {
+	errs  []base.CrawlerError // 错误。
+	next  int                 // 下一个写入的位置。
+	full  bool                // 是否已经写满过一轮。
+	mutex sync.Mutex          // 互斥锁。
+}
+
+// 创建最近错误的环形缓冲区。
+func newErrorRing(capacity int) *errorRing {
+	return &errorRing{errs: make([]base.CrawlerError, capacity)}
+}
+
+func (ring *errorRing) add(err base.CrawlerError) {
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+	ring.errs[ring.next] = err
+	ring.next = (ring.next + 1) % len(ring.errs)
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+// 按照从旧到新的顺序获得其中的错误。
+func (ring *errorRing) list() []base.CrawlerError {
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+	if !ring.full {
+		return append([]base.CrawlerError(nil), ring.errs[:ring.next]...)
+	}
+	errs := make([]base.CrawlerError, 0, len(ring.errs))
+	errs = append(errs, ring.errs[ring.next:]...)
+	return append(errs, ring.errs[:ring.next]...)
+}
+
+// 在爬取范围策略的读锁之下检查请求。
+func (sched *myScheduler) checkScope(req *base.Request, parent *base.Request) error {
+	sched.scopeLock.RLock()
+	defer sched.scopeLock.RUnlock()
+	return sched.scopePolicy.Check(req, parent)
+}
+
+func (sched *myScheduler) AddSeeds(httpReqs ...*http.Request) (int, error) {
+	if !sched.Running() || sched.isDraining() {
+		return 0, errors.New("The scheduler is not running!\n")
+	}
+	seeds := make([]*base.Request, 0, len(httpReqs))
+	for i, httpReq := range httpReqs {
+		if httpReq == nil || httpReq.URL == nil {
+			return 0, fmt.Errorf("The %dth seed request is invalid!", i)
+		}
+		seeds = append(seeds, base.NewRequest(httpReq, 0))
+	}
+	// 新的种子会扩展当前的爬取范围，例如同主域名策略会加入它们的主域名。
+	// 策略需要以全部种子重新初始化，否则像路径前缀策略这样的策略会丢掉原有种子的范围。
+	sched.scopeLock.Lock()
+	allSeeds := append(append(make([]*base.Request, 0, len(sched.seeds)+len(seeds)), sched.seeds...), seeds...)
+	err := sched.scopePolicy.Init(allSeeds)
+	if err == nil {
+		sched.seeds = allSeeds
+	}
+	sched.scopeLock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	accepted := 0
+	for _, seed := range seeds {
+		if sched.saveReqToCache(*seed, nil, SCHEDULER_CODE) {
+			accepted++
+		}
+	}
+	golog.Infof("Added %d/%d seed requests.\n", accepted, len(seeds))
+	return accepted, nil
+}
+
+func (sched *myScheduler) SetScope(scope ScopePolicy) error {
+	if scope == nil {
+		return errors.New("The scope policy is invalid!\n")
+	}
+	if !sched.Running() {
+		return errors.New("The scheduler is not running! Use WithScope or Config.Scope instead.\n")
+	}
+	sched.scopeLock.Lock()
+	defer sched.scopeLock.Unlock()
+	if err := scope.Init(sched.seeds); err != nil {
+		return err
+	}
+	golog.Infof("The scope policy has been changed from %s to %s.\n", sched.scopePolicy, scope)
+	sched.scopePolicy = scope
+	return nil
+}
+
+func (sched *myScheduler) Scope() ScopePolicy {
+	sched.scopeLock.RLock()
+	defer sched.scopeLock.RUnlock()
+	return sched.scopePolicy
+}
+
+func (sched *myScheduler) Frontier(limit int) []base.Request {
+	if sched.reqCache == nil {
+		return nil
+	}
+	reqs := sched.reqCache.list(limit)
+	result := make([]base.Request, 0, len(reqs))
+	for _, req := range reqs {
+		result = append(result, *req)
+	}
+	return result
+}
+
+func (sched *myScheduler) RecentErrors() []base.CrawlerError {
+	if sched.recentErrors == nil {
+		return nil
+	}
+	return sched.recentErrors.list()
+}
+
+func (sched *myScheduler) SeenURLs() []string {
+	if sched.urlSet == nil {
+		return nil
+	}
+	return sched.urlSet.keys()
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"webcrawler/base"
+	"webcrawler/deadletter"
+
+	"github.com/kataras/golog"
+)
+
+// 保存死信。保存失败时只记录日志，以免影响爬取流程。
+func (sched *myScheduler) saveDeadLetter(entry *deadletter.Entry) {
+	if sched.deadLetters == nil {
+		return
+	}
+	if err := sched.deadLetters.Put(entry); err != nil {
+		golog.Errorf("Occur error when save dead letter (kind=%s): %s\n", entry.Kind, err)
+	}
+}
+
+func (sched *myScheduler) Replay(entries []*deadletter.Entry) (int, error) {
+	if !sched.Running() || sched.isDraining() {
+		return 0, errors.New("The scheduler is not running!\n")
+	}
+	accepted := 0
+	for i, entry := range entries {
+		if entry == nil {
+			return accepted, fmt.Errorf("The %dth dead letter is invalid!", i)
+		}
+		switch entry.Kind {
+		case deadletter.KIND_REQUEST:
+			req, err := entry.ToRequest()
+			if err != nil {
+				golog.Warnf("Ignore the dead letter! %s\n", err)
+				continue
+			}
+			if sched.replayRequest(req) {
+				accepted++
+			}
+		case deadletter.KIND_ITEM:
+			if entry.Item == nil {
+				golog.Warn("Ignore the dead letter! Its item is empty.\n")
+				continue
+			}
+			if sched.sendItem(entry.Item, SCHEDULER_CODE) {
+				accepted++
+			}
+		default:
+			golog.Warnf("Ignore the dead letter! Unknown kind '%s'.\n", entry.Kind)
+		}
+	}
+	golog.Infof("Replayed %d/%d dead letters.\n", accepted, len(entries))
+	return accepted, nil
+}
+
+// 重新放入死信中的请求。已见过的URL需要绕过去重才能被重新下载，
+// 但仍然要经过与新请求相同的协议、爬取范围、深度和robots.txt检查，因为它们可能在此期间发生了变化。
+func (sched *myScheduler) replayRequest(req *base.Request) bool {
+	reqUrl := req.HttpReq().URL
+	if err := sched.schemePolicy.Check(reqUrl); err != nil {
+		golog.Warnf("Ignore the dead letter! %s (requestUrl=%s)\n", err, reqUrl)
+		sched.filtered(req, FILTER_SCHEME, err.Error())
+		return false
+	}
+	if !sched.urlSet.has(sched.schemePolicy.Key(reqUrl)) {
+		return sched.saveReqToCache(*req, nil, SCHEDULER_CODE)
+	}
+	if !sched.admit(req, nil) {
+		return false
+	}
+	return sched.requeue(*req)
+}
+
+// 获得死信存储的摘要信息。
+func (sched *myScheduler) deadLetterSummary() string {
+	if sched.deadLetters == nil {
+		return "<disabled>"
+	}
+	return sched.deadLetters.Summary()
+}
@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"webcrawler/base"
+
+	"github.com/kataras/golog"
+)
+
+// 事件的类型。
+type EventType string
+
+const (
+	EVENT_REQUEST_QUEUED   EventType = "request.queued"   // 请求被放入请求缓存。
+	EVENT_REQUEST_DEDUPED  EventType = "request.deduped"  // 请求因URL重复而被忽略。
+	EVENT_REQUEST_FILTERED EventType = "request.filtered" // 请求被过滤，原因见Reason。
+	EVENT_RESPONSE_FETCHED EventType = "response.fetched" // 响应已被下载。
+	EVENT_RESPONSE_PARSED  EventType = "response.parsed"  // 响应已被分析。
+	EVENT_ITEM_EMITTED     EventType = "item.emitted"     // 分析器生成了条目。
+	EVENT_ERROR            EventType = "error"            // 错误被发送到错误通道。
+)
+
+// 默认的事件缓冲区的长度。
+const DEFAULT_EVENT_BUFFER = 1024
+
+// 爬取过程中的事件。只有与事件类型有关的字段才会被设置。
+// 监听器不应修改其中的请求、响应和条目。
+type Event struct {
+	Type     EventType         // 类型。
+	Time     time.Time         // 发生的时间。
+	Request  *base.Request     // 相关的请求。
+	Response *base.Response    // 相关的响应。
+	Item     base.Item         // 相关的条目。
+	Reason   string            // 请求被过滤的原因，即FILTER_*之一。
+	Detail   string            // 补充说明，例如请求被过滤的具体原因。
+	Elapsed  time.Duration     // 下载或分析所花费的时间。
+	Err      base.CrawlerError // 相关的错误。
+}
+
+// 事件监听器的接口类型。
+type Listener interface {
+	// 处理事件。同一个监听器的事件会在同一个goroutine中按照发生的顺序被依次处理。
+	OnEvent(event *Event)
+}
+
+// 把函数用作事件监听器。
+type ListenerFunc func(event *Event)
+
+func (f ListenerFunc) OnEvent(event *Event) {
+	f(event)
+}
+
+// 已注册的监听器。
+type subscription struct {
+	listener Listener           // 监听器。
+	buffer   int                // 缓冲区的长度。
+	types    map[EventType]bool // 关注的事件类型，为nil表示全部。
+}
+
+// 事件的订阅者。每个订阅者都有自己的缓冲区和goroutine。
+type subscriber struct {
+	subscription
+	events    chan *Event // 事件缓冲区。
+	delivered uint64      // 已处理的事件数。
+	dropped   uint64      // 因缓冲区已满而被丢弃的事件数。
+}
+
+// 事件总线。发布事件永远不会阻塞爬取流程：缓冲区已满时事件会被丢弃。
+// 它的方法在接收者为nil时什么也不做。
+type eventBus struct {
+	subscribers []*subscriber  // 订阅者。
+	closed      bool           // 是否已关闭。
+	rwmutex     sync.RWMutex   // 发布时持有读锁，关闭时持有写锁。
+	wg          sync.WaitGroup // 等待各订阅者处理完剩余的事件。
+}
+
+// 根据已注册的监听器创建事件总线，并启动各订阅者的goroutine。若没有监听器则返回nil。
+func newEventBus(subscriptions []subscription) *eventBus {
+	if len(subscriptions) == 0 {
+		return nil
+	}
+	bus := &eventBus{}
+	for _, sub := range subscriptions {
+		s := &subscriber{subscription: sub, events: make(chan *Event, sub.buffer)}
+		bus.subscribers = append(bus.subscribers, s)
+		bus.wg.Add(1)
+		go bus.deliver(s)
+	}
+	return bus
+}
+
+// 把事件交给订阅者的监听器。监听器引发的运行时恐慌只会被记录下来。
+func (bus *eventBus) deliver(s *subscriber) {
+	defer bus.wg.Done()
+	for event := range s.events {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					golog.Errorf("Fatal event listener error (event=%s): %v\n", event.Type, p)
+				}
+			}()
+			s.listener.OnEvent(event)
+		}()
+		atomic.AddUint64(&s.delivered, 1)
+	}
+}
+
+// 发布事件。
+func (bus *eventBus) publish(event *Event) {
+	bus.rwmutex.RLock()
+	defer bus.rwmutex.RUnlock()
+	if bus.closed {
+		return
+	}
+	for _, s := range bus.subscribers {
+		if s.types != nil && !s.types[event.Type] {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// 发布与请求有关的事件。
+func (bus *eventBus) request(typ EventType, req *base.Request, reason string, detail string) {
+	if bus == nil {
+		return
+	}
+	bus.publish(&Event{Type: typ, Time: time.Now(), Request: req, Reason: reason, Detail: detail})
+}
+
+// 发布与响应有关的事件。
+func (bus *eventBus) response(typ EventType, resp *base.Response, elapsed time.Duration) {
+	if bus == nil {
+		return
+	}
+	bus.publish(&Event{Type: typ, Time: time.Now(), Request: resp.Request(), Response: resp, Elapsed: elapsed})
+}
+
+// 发布条目事件。参数resp代表生成条目的响应。
+func (bus *eventBus) item(item base.Item, resp *base.Response) {
+	if bus == nil {
+		return
+	}
+	bus.publish(&Event{Type: EVENT_ITEM_EMITTED, Time: time.Now(), Request: resp.Request(), Response: resp, Item: item})
+}
+
+// 发布错误事件。
+func (bus *eventBus) error(err base.CrawlerError) {
+	if bus == nil {
+		return
+	}
+	bus.publish(&Event{Type: EVENT_ERROR, Time: time.Now(), Err: err})
+}
+
+// 关闭事件总线，并等待各监听器处理完缓冲区中剩余的事件。
+func (bus *eventBus) close() {
+	if bus == nil {
+		return
+	}
+	bus.rwmutex.Lock()
+	if bus.closed {
+		bus.rwmutex.Unlock()
+		return
+	}
+	bus.closed = true
+	for _, s := range bus.subscribers {
+		close(s.events)
+	}
+	bus.rwmutex.Unlock()
+	bus.wg.Wait()
+}
+
+// 获得已处理和已丢弃的事件的总数。
+func (bus *eventBus) stats() *EventsSnapshot {
+	if bus == nil {
+		return nil
+	}
+	stats := &EventsSnapshot{Listeners: len(bus.subscribers)}
+	for _, s := range bus.subscribers {
+		stats.Delivered += atomic.LoadUint64(&s.delivered)
+		stats.Dropped += atomic.LoadUint64(&s.dropped)
+	}
+	return stats
+}
+
+// 记录请求被放入请求缓存。
+func (sched *myScheduler) queued(req *base.Request) {
+	sched.metrics.incQueued()
+	sched.events.request(EVENT_REQUEST_QUEUED, req, "", "")
+}
+
+// 记录请求因URL重复而被忽略。
+func (sched *myScheduler) deduped(req *base.Request) {
+	sched.metrics.incDeduped()
+	sched.events.request(EVENT_REQUEST_DEDUPED, req, "", "")
+}
+
+// 记录请求被过滤。参数reason是FILTER_*之一，参数detail是具体的原因。
+func (sched *myScheduler) filtered(req *base.Request, reason string, detail string) {
+	sched.metrics.incFiltered(reason)
+	sched.events.request(EVENT_REQUEST_FILTERED, req, reason, detail)
+}
+
+func (sched *myScheduler) AddListener(listener Listener, buffer int, types ...EventType) error {
+	if listener == nil {
+		return errors.New("The event listener is invalid!\n")
+	}
+	if buffer < 0 {
+		return fmt.Errorf("Invalid event buffer size %d!\n", buffer)
+	}
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The event listeners can not be changed while the scheduler is running!\n")
+	}
+	if buffer == 0 {
+		buffer = DEFAULT_EVENT_BUFFER
+	}
+	sub := subscription{listener: listener, buffer: buffer}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool, len(types))
+		for _, typ := range types {
+			sub.types[typ] = true
+		}
+	}
+	sched.listeners = append(sched.listeners, sub)
+	return nil
+}
@@ -0,0 +1,445 @@
+package scheduler
+
+import (
+	"container/heap"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+	"webcrawler/base"
+)
+
+// 请求评分函数的类型。
+// 参数parent代表发现该请求的页面所对应的请求，对种子请求而言为nil。
+// 结果值会成为请求的优先级，优先级越高的请求越先被调度。
+type ScoreRequest func(req *base.Request, parent *base.Request) float64
+
+// 请求缓存的调度策略。
+type FrontierStrategy struct {
+	Name  string       // 策略的名称。
+	Score ScoreRequest // 评分函数。若为nil，则保留请求原有的优先级。
+	LIFO  bool         // 优先级相同的请求是否后进先出。
+}
+
+var (
+	// 广度优先：深度越小越先被调度，同深度的请求先进先出。
+	BFS = &FrontierStrategy{
+		Name:  "bfs",
+		Score: ScoreByDepth(1),
+	}
+	// 深度优先：深度越大越先被调度，同深度的请求后进先出。
+	DFS = &FrontierStrategy{
+		Name:  "dfs",
+		Score: ScoreByDepth(-1),
+		LIFO:  true,
+	}
+)
+
+// 创建最佳优先的策略。参数score为nil时，使用解析函数为请求设置的优先级。
+func BestFirst(score ScoreRequest) *FrontierStrategy {
+	return &FrontierStrategy{Name: "best-first", Score: score}
+}
+
+// 创建根据深度评分的函数。评分为深度乘以-weight。
+func ScoreByDepth(weight float64) ScoreRequest {
+	return func(req *base.Request, parent *base.Request) float64 {
+		return -weight * float64(req.Depth())
+	}
+}
+
+// 创建根据URL模式评分的函数。评分为URL所匹配的所有模式的权重之和。
+func ScoreByPattern(patterns map[string]float64) (ScoreRequest, error) {
+	type weightedPattern struct {
+		re     *regexp.Regexp
+		weight float64
+	}
+	compiled := make([]weightedPattern, 0, len(patterns))
+	for expr, weight := range patterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid url pattern '%s': %s", expr, err)
+		}
+		compiled = append(compiled, weightedPattern{re: re, weight: weight})
+	}
+	return func(req *base.Request, parent *base.Request) float64 {
+		var score float64
+		reqUrl := req.HttpReq().URL.String()
+		for _, p := range compiled {
+			if p.re.MatchString(reqUrl) {
+				score += p.weight
+			}
+		}
+		return score
+	}, nil
+}
+
+// 创建根据父请求的优先级评分的函数。评分为父请求的优先级乘以decay。
+func ScoreByParent(decay float64) ScoreRequest {
+	return func(req *base.Request, parent *base.Request) float64 {
+		if parent == nil {
+			return 0
+		}
+		return decay * parent.Priority()
+	}
+}
+
+// 创建根据请求的附加属性评分的函数。评分为数值型属性的值乘以weight。
+func ScoreByAttr(key string, weight float64) ScoreRequest {
+	return func(req *base.Request, parent *base.Request) float64 {
+		v, ok := req.Attr(key)
+		if !ok {
+			return 0
+		}
+		switch n := v.(type) {
+		case float64:
+			return weight * n
+		case float32:
+			return weight * float64(n)
+		case int:
+			return weight * float64(n)
+		case int64:
+			return weight * float64(n)
+		case uint32:
+			return weight * float64(n)
+		}
+		return 0
+	}
+}
+
+// 创建把多个评分函数的结果相加的函数。
+func SumScores(scores ...ScoreRequest) ScoreRequest {
+	return func(req *base.Request, parent *base.Request) float64 {
+		var total float64
+		for _, score := range scores {
+			total += score(req, parent)
+		}
+		return total
+	}
+}
+
+// 被放入优先级队列的请求。
+type queuedRequest struct {
+	req *base.Request // 请求。
+	seq uint64        // 放入时的序号。
+}
+
+// 单个主机的请求优先级队列，实现了heap.Interface。
+type reqQueue struct {
+	items []*queuedRequest // 请求的堆。
+	lifo  bool             // 同优先级的请求是否后进先出。
+}
+
+func (q *reqQueue) Len() int {
+	return len(q.items)
+}
+
+func (q *reqQueue) Less(i, j int) bool {
+	pi, pj := q.items[i].req.Priority(), q.items[j].req.Priority()
+	if pi != pj {
+		return pi > pj
+	}
+	if q.lifo {
+		return q.items[i].seq > q.items[j].seq
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q *reqQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+}
+
+func (q *reqQueue) Push(x interface{}) {
+	q.items = append(q.items, x.(*queuedRequest))
+}
+
+func (q *reqQueue) Pop() interface{} {
+	n := len(q.items)
+	item := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	return item
+}
+
+// 尚未到可调度时间的请求。
+type delayedRequest struct {
+	req *base.Request // 请求。
+	key string        // 请求所属队列的键。
+}
+
+// 按照可调度时间排序的请求队列，实现了heap.Interface。
+type delayQueue []*delayedRequest
+
+func (q delayQueue) Len() int {
+	return len(q)
+}
+
+func (q delayQueue) Less(i, j int) bool {
+	return q[i].req.NotBefore().Before(q[j].req.NotBefore())
+}
+
+func (q delayQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *delayQueue) Push(x interface{}) {
+	*q = append(*q, x.(*delayedRequest))
+}
+
+func (q *delayQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+// 创建按优先级调度的请求缓存。
+// 请求会按照主机被分到不同的队列中，各队列轮流出队以保证公平，
+// 每个队列内部则按照优先级出队。
+// 参数strategy为nil时，每个队列内部先进先出。
+// 参数limiter不为nil时，只有其允许的主机的队列才会出队，
+// 此时队列按照限制器的限制键（主机名或IP地址）划分。
+// 尚未到可调度时间（见base.Request.NotBefore）的请求会暂存在单独的队列中，到时之后才会进入其主机的队列。
+// 参数ready不为nil时，队首请求不满足它的队列会被扣留，此时不会占用礼貌限制的名额。
+func newPriorityCache(strategy *FrontierStrategy, limiter *hostLimiter, ready func(req *base.Request) bool) requestCache {
+	if strategy == nil {
+		strategy = &FrontierStrategy{Name: "fifo"}
+	}
+	return &reqCacheByPriority{
+		strategy: strategy,
+		limiter:  limiter,
+		ready:    ready,
+		queues:   make(map[string]*reqQueue),
+		acquired: make(map[*http.Request]string),
+	}
+}
+
+// 按优先级调度的请求缓存的实现类型。
+type reqCacheByPriority struct {
+	strategy *FrontierStrategy            // 调度策略。
+	limiter  *hostLimiter                 // 主机礼貌限制器，可能为nil。
+	ready    func(req *base.Request) bool // 判断请求是否可被调度的函数，可能为nil。
+	queues   map[string]*reqQueue         // 各主机的队列。
+	acquired map[*http.Request]string     // 已出队且占用了礼貌限制名额的请求所对应的限制键。
+	ring     []string                     // 非空队列所对应的主机，按轮转顺序排列。
+	delayed  delayQueue                   // 尚未到可调度时间的请求。
+	next     int                          // 下一个出队的队列在ring中的索引。
+	seq      uint64                       // 最近一次放入的序号。
+	count    int                          // 请求的总数。
+	mutex    sync.Mutex                   // 互斥锁。
+	status   byte                         // 缓存状态。0表示正在运行，1表示已关闭。
+}
+
+func (rcache *reqCacheByPriority) put(req *base.Request) bool {
+	if req == nil {
+		return false
+	}
+	key := rcache.keyOf(req)
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	if rcache.status == 1 {
+		return false
+	}
+	if req.NotBefore().After(time.Now()) {
+		heap.Push(&rcache.delayed, &delayedRequest{req: req, key: key})
+	} else {
+		rcache.enqueue(key, req)
+	}
+	rcache.count++
+	return true
+}
+
+// 把请求放入其主机的队列。调用方需持有锁。
+func (rcache *reqCacheByPriority) enqueue(key string, req *base.Request) {
+	queue, ok := rcache.queues[key]
+	if !ok {
+		queue = &reqQueue{lifo: rcache.strategy.LIFO}
+		rcache.queues[key] = queue
+		rcache.ring = append(rcache.ring, key)
+	}
+	rcache.seq++
+	heap.Push(queue, &queuedRequest{req: req, seq: rcache.seq})
+}
+
+// 把已到可调度时间的请求移入其主机的队列。调用方需持有锁。
+func (rcache *reqCacheByPriority) promote() {
+	now := time.Now()
+	for rcache.delayed.Len() > 0 && !rcache.delayed[0].req.NotBefore().After(now) {
+		item := heap.Pop(&rcache.delayed).(*delayedRequest)
+		rcache.enqueue(item.key, item.req)
+	}
+}
+
+func (rcache *reqCacheByPriority) get() *base.Request {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	if rcache.status == 1 || rcache.count == 0 {
+		return nil
+	}
+	rcache.promote()
+	for i := 0; i < len(rcache.ring); i++ {
+		if rcache.next >= len(rcache.ring) {
+			rcache.next = 0
+		}
+		key := rcache.ring[rcache.next]
+		queue := rcache.queues[key]
+		if rcache.ready != nil && !rcache.ready(queue.items[0].req) {
+			rcache.next++
+			continue
+		}
+		if rcache.limiter != nil && !rcache.limiter.acquire(key, queue.items[0].req) {
+			rcache.next++
+			continue
+		}
+		item := heap.Pop(queue).(*queuedRequest)
+		rcache.count--
+		if rcache.limiter != nil {
+			// 释放名额时要使用与占用时相同的键，因为礼貌参数可能在运行期间被替换。
+			rcache.acquired[item.req.HttpReq()] = key
+		}
+		if queue.Len() == 0 {
+			delete(rcache.queues, key)
+			rcache.ring = append(rcache.ring[:rcache.next], rcache.ring[rcache.next+1:]...)
+		} else {
+			rcache.next++
+		}
+		return item.req
+	}
+	return nil
+}
+
+func (rcache *reqCacheByPriority) done(req *base.Request) {
+	if rcache.limiter == nil {
+		return
+	}
+	rcache.mutex.Lock()
+	key, ok := rcache.acquired[req.HttpReq()]
+	delete(rcache.acquired, req.HttpReq())
+	rcache.mutex.Unlock()
+	if ok {
+		rcache.limiter.release(key)
+	}
+}
+
+func (rcache *reqCacheByPriority) drain() []*base.Request {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	reqs := make([]*base.Request, 0, rcache.count)
+	for _, key := range rcache.ring {
+		queue := rcache.queues[key]
+		for queue.Len() > 0 {
+			reqs = append(reqs, heap.Pop(queue).(*queuedRequest).req)
+		}
+	}
+	for rcache.delayed.Len() > 0 {
+		reqs = append(reqs, heap.Pop(&rcache.delayed).(*delayedRequest).req)
+	}
+	rcache.queues = make(map[string]*reqQueue)
+	rcache.ring = nil
+	rcache.next = 0
+	rcache.count = 0
+	return reqs
+}
+
+// 获得请求所属队列的键。
+func (rcache *reqCacheByPriority) keyOf(req *base.Request) string {
+	if rcache.limiter != nil {
+		return rcache.limiter.keyOf(req)
+	}
+	return hostOf(req)
+}
+
+func (rcache *reqCacheByPriority) capacity() int {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	var total int
+	for _, queue := range rcache.queues {
+		total += cap(queue.items)
+	}
+	return total
+}
+
+func (rcache *reqCacheByPriority) length() int {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	return rcache.count
+}
+
+func (rcache *reqCacheByPriority) close() {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	rcache.status = 1
+}
+
+// 各主机队列中的请求按照优先级和放入的顺序排列，等待重试的请求按照可调度时间排在最后。
+// 实际的调度顺序还取决于主机之间的轮转和礼貌限制。
+func (rcache *reqCacheByPriority) list(limit int) []*base.Request {
+	rcache.mutex.Lock()
+	defer rcache.mutex.Unlock()
+	queued := make([]*queuedRequest, 0, rcache.count)
+	for _, q := range rcache.queues {
+		queued = append(queued, q.items...)
+	}
+	lifo := rcache.strategy.LIFO
+	sort.Slice(queued, func(i, j int) bool {
+		pi, pj := queued[i].req.Priority(), queued[j].req.Priority()
+		if pi != pj {
+			return pi > pj
+		}
+		if lifo {
+			return queued[i].seq > queued[j].seq
+		}
+		return queued[i].seq < queued[j].seq
+	})
+	delayed := append(delayQueue(nil), rcache.delayed...)
+	sort.Sort(delayed)
+	reqs := make([]*base.Request, 0, len(queued)+len(delayed))
+	for _, item := range queued {
+		reqs = append(reqs, item.req)
+	}
+	for _, item := range delayed {
+		reqs = append(reqs, item.req)
+	}
+	if limit > 0 && limit < len(reqs) {
+		reqs = reqs[:limit]
+	}
+	return reqs
+}
+
+func (rcache *reqCacheByPriority) stats() ReqCacheSnapshot {
+	rcache.mutex.Lock()
+	stats := ReqCacheSnapshot{
+		Status:   statusMap[rcache.status],
+		Length:   rcache.count,
+		Strategy: rcache.strategy.Name,
+		Queues:   len(rcache.queues),
+		Delayed:  rcache.delayed.Len(),
+	}
+	rcache.mutex.Unlock()
+	stats.Capacity = rcache.capacity()
+	if rcache.limiter != nil {
+		stats.Hosts, stats.ActiveHosts = rcache.limiter.stats()
+	}
+	return stats
+}
+
+func (rcache *reqCacheByPriority) summary() string {
+	rcache.mutex.Lock()
+	queueCount := len(rcache.queues)
+	delayedCount := rcache.delayed.Len()
+	status := rcache.status
+	rcache.mutex.Unlock()
+	summary := fmt.Sprintf(summaryTemplate,
+		statusMap[status],
+		rcache.length(),
+		rcache.capacity())
+	summary = fmt.Sprintf("%s, strategy: %s, queues: %d, delayed: %d",
+		summary, rcache.strategy.Name, queueCount, delayedCount)
+	if rcache.limiter != nil {
+		summary = fmt.Sprintf("%s, politeness: { %s }", summary, rcache.limiter.summary())
+	}
+	return summary
+}
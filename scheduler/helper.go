@@ -8,8 +8,6 @@ import (
 	"webcrawler/itempipeline"
 	"fmt"
 	"strings"
-	"regexp"
-	"errors"
 )
 
 func generateChannelManager(channelArgs base.ChannelArgs) middleware.ChannelManager {
@@ -36,14 +34,42 @@ func generateAnalyzerPool(poolSize uint32) (analyzer.AnalyzerPool, error) {
 	return pool, nil
 }
 
-func generateItemPipeline(itemProcessors []itempipeline.ProcessItem) itempipeline.ItemPipeline{
-	return itempipeline.NewItemPipeline(itemProcessors)
+// 把条目处理函数列表转换为分级的条目处理管道的各级。
+// 每个处理函数都是单独的一级,只有一个工作协程和长度为1的队列,
+// 因此条目会按照发送的顺序被依次处理,且处理缓慢时压力会传递到条目通道。
+func generateItemStages(itemProcessors []itempipeline.ProcessItem) []itempipeline.Stage {
+	if len(itemProcessors) == 0 {
+		// 没有处理函数时条目会被直接视为已处理。
+		passThrough := func(item base.Item) (base.Item, error) {
+			return item, nil
+		}
+		return []itempipeline.Stage{{Name: "pass-through", Processor: passThrough}}
+	}
+	stages := make([]itempipeline.Stage, 0, len(itemProcessors))
+	for i, ip := range itemProcessors {
+		stages = append(stages, itempipeline.Stage{Name: fmt.Sprintf("processor-%d", i), Processor: ip})
+	}
+	return stages
 }
 //生成组件实例代号
 func generateCode(prefix string,id uint32) string{
 	return fmt.Sprintf("%s-%d",prefix,id)
 }
 
+// 根据组件实例代号获得错误类型。
+func errorTypeOf(code string) base.ErrorType {
+	switch parseCode(code)[0] {
+	case DOWNLOADER_CODE:
+		return base.DOWNLOADER_ERROR
+	case ANALYZER_CODE:
+		return base.ANALYZER_ERROR
+	case ITEMPIPELINE_CODE:
+		return base.ITEM_PROCESSOR_ERROR
+	default:
+		return base.SCHEDULER_ERROR
+	}
+}
+
 // 解析组件实例代号。
 func parseCode(code string) []string {
 	result := make([]string, 2)
@@ -60,57 +86,3 @@ func parseCode(code string) []string {
 	result[1] = id
 	return result
 }
-
-var regexpForIp = regexp.MustCompile(`((?:(?:25[0-5]|2[0-4]\d|[01]?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|[01]?\d?\d))`)
-
-var regexpForDomains = []*regexp.Regexp{
-	// *.xx or *.xxx.xx
-	regexp.MustCompile(`\.(com|com\.\w{2})$`),
-	regexp.MustCompile(`\.(gov|gov\.\w{2})$`),
-	regexp.MustCompile(`\.(net|net\.\w{2})$`),
-	regexp.MustCompile(`\.(org|org\.\w{2})$`),
-	// *.xx
-	regexp.MustCompile(`\.me$`),
-	regexp.MustCompile(`\.biz$`),
-	regexp.MustCompile(`\.info$`),
-	regexp.MustCompile(`\.name$`),
-	regexp.MustCompile(`\.mobi$`),
-	regexp.MustCompile(`\.so$`),
-	regexp.MustCompile(`\.asia$`),
-	regexp.MustCompile(`\.tel$`),
-	regexp.MustCompile(`\.tv$`),
-	regexp.MustCompile(`\.cc$`),
-	regexp.MustCompile(`\.co$`),
-	regexp.MustCompile(`\.\w{2}$`),
-}
-
-func getPrimaryDomain(host string) (string, error) {
-	host = strings.TrimSpace(host)
-	if host == "" {
-		return "", errors.New("The host is empty!")
-	}
-	if regexpForIp.MatchString(host) {
-		return host, nil
-	}
-	var suffixIndex int
-	for _, re := range regexpForDomains {
-		pos := re.FindStringIndex(host)
-		if pos != nil {
-			suffixIndex = pos[0]
-			break
-		}
-	}
-	if suffixIndex > 0 {
-		var pdIndex int
-		firstPart := host[:suffixIndex]
-		index := strings.LastIndex(firstPart, ".")
-		if index < 0 {
-			pdIndex = 0
-		} else {
-			pdIndex = index + 1
-		}
-		return host[pdIndex:], nil
-	} else {
-		return "", errors.New("Unrecognized host!")
-	}
-}
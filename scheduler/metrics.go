@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+	"webcrawler/itempipeline"
+	"webcrawler/metrics"
+)
+
+// 请求被过滤的原因。
+const (
+	FILTER_INVALID  = "invalid"  // HTTP请求或URL无效。
+	FILTER_SCHEME   = "scheme"   // URL协议不被允许。
+	FILTER_SCOPE    = "scope"    // 超出爬取范围。
+	FILTER_DEPTH    = "depth"    // 超出爬取深度。
+	FILTER_ROBOTS   = "robots"   // 被robots.txt禁止。
+	FILTER_SHUTDOWN = "shutdown" // 调度器正在关闭。
+)
+
+// 调度器的指标。它的方法在接收者为nil时什么也不做。
+type crawlerMetrics struct {
+	queued    *metrics.Counter   // 被放入请求缓存的请求。
+	fetched   *metrics.Counter   // 已下载的请求。
+	deduped   *metrics.Counter   // 因URL重复而被忽略的请求。
+	filtered  *metrics.Counter   // 被过滤的请求，按原因分组。
+	responses *metrics.Counter   // 响应，按状态码类别分组。
+	download  *metrics.Histogram // 下载耗时。
+	parse     *metrics.Histogram // 分析耗时。
+	errors    *metrics.Counter   // 错误，按错误类型分组。
+}
+
+// 创建调度器的指标，并把它们注册到参数registry中。
+// 池、通道和条目处理管道的状态会在收集时从调度器中读取。
+func newCrawlerMetrics(sched *myScheduler, registry *metrics.Registry) (*crawlerMetrics, error) {
+	m := &crawlerMetrics{
+		queued: metrics.NewCounter("webcrawler_requests_queued_total",
+			"Requests put into the request cache."),
+		fetched: metrics.NewCounter("webcrawler_requests_fetched_total",
+			"Requests downloaded successfully."),
+		deduped: metrics.NewCounter("webcrawler_requests_deduped_total",
+			"Requests ignored because their URL has been seen."),
+		filtered: metrics.NewCounter("webcrawler_requests_filtered_total",
+			"Requests ignored by the scheduler, by reason.", "reason"),
+		responses: metrics.NewCounter("webcrawler_responses_total",
+			"Responses received, by status class.", "class"),
+		download: metrics.NewHistogram("webcrawler_download_duration_seconds",
+			"Time spent downloading a page.", nil),
+		parse: metrics.NewHistogram("webcrawler_parse_duration_seconds",
+			"Time spent analyzing a response.", nil),
+		errors: metrics.NewCounter("webcrawler_errors_total",
+			"Errors sent to the error channel, by type.", "type"),
+	}
+	err := registry.Register(m.queued, m.fetched, m.deduped, m.filtered,
+		m.responses, m.download, m.parse, m.errors,
+		metrics.NewGaugeFunc("webcrawler_pool_used",
+			"Entities taken from the pool.", []string{"pool"}, sched.collectPools(false)),
+		metrics.NewGaugeFunc("webcrawler_pool_total",
+			"Capacity of the pool.", []string{"pool"}, sched.collectPools(true)),
+		metrics.NewGaugeFunc("webcrawler_channel_length",
+			"Elements buffered in the channel.", []string{"channel"}, sched.collectChannels(false)),
+		metrics.NewGaugeFunc("webcrawler_channel_capacity",
+			"Capacity of the channel.", []string{"channel"}, sched.collectChannels(true)),
+		metrics.NewCounterFunc("webcrawler_items_total",
+			"Items handled by the item pipeline, by state.", []string{"state"}, sched.collectItems),
+		metrics.NewCounterFunc("webcrawler_stage_items_total",
+			"Items processed by each item pipeline stage.", []string{"stage"}, sched.collectStages(false)),
+		metrics.NewGaugeFunc("webcrawler_stage_queue_length",
+			"Items waiting in the queue of each item pipeline stage.", []string{"stage"}, sched.collectStages(true)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *crawlerMetrics) incQueued() {
+	if m != nil {
+		m.queued.Inc()
+	}
+}
+
+func (m *crawlerMetrics) incDeduped() {
+	if m != nil {
+		m.deduped.Inc()
+	}
+}
+
+func (m *crawlerMetrics) incFiltered(reason string) {
+	if m != nil {
+		m.filtered.Inc(reason)
+	}
+}
+
+// 记录一次下载。参数statusCode为0表示下载失败。
+func (m *crawlerMetrics) observeDownload(elapsed time.Duration, statusCode int) {
+	if m == nil {
+		return
+	}
+	m.download.Observe(elapsed.Seconds())
+	if statusCode > 0 {
+		m.fetched.Inc()
+		m.responses.Inc(fmt.Sprintf("%dxx", statusCode/100))
+	}
+}
+
+func (m *crawlerMetrics) observeParse(elapsed time.Duration) {
+	if m != nil {
+		m.parse.Observe(elapsed.Seconds())
+	}
+}
+
+func (m *crawlerMetrics) incErrors(errType string) {
+	if m != nil {
+		m.errors.Inc(errType)
+	}
+}
+
+// 获得收集池状态的函数。
+func (sched *myScheduler) collectPools(total bool) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		if !sched.Running() {
+			return nil
+		}
+		dl, ana := sched.dlpool.Used(), sched.analyzerPool.Used()
+		if total {
+			dl, ana = sched.dlpool.Total(), sched.analyzerPool.Total()
+		}
+		return []metrics.Sample{
+			{LabelValues: []string{"downloader"}, Value: float64(dl)},
+			{LabelValues: []string{"analyzer"}, Value: float64(ana)},
+		}
+	}
+}
+
+// 获得收集通道状态的函数。
+func (sched *myScheduler) collectChannels(capacity bool) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		if !sched.Running() {
+			return nil
+		}
+		reqChan, err1 := sched.chanman.ReqChan()
+		respChan, err2 := sched.chanman.RespChan()
+		itemChan, err3 := sched.chanman.ItemChan()
+		errorChan, err4 := sched.chanman.ErrorChan()
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil
+		}
+		values := []int{len(reqChan), len(respChan), len(itemChan), len(errorChan)}
+		if capacity {
+			values = []int{cap(reqChan), cap(respChan), cap(itemChan), cap(errorChan)}
+		}
+		names := []string{"request", "response", "item", "error"}
+		samples := make([]metrics.Sample, 0, len(names))
+		for i, name := range names {
+			samples = append(samples, metrics.Sample{LabelValues: []string{name}, Value: float64(values[i])})
+		}
+		return samples
+	}
+}
+
+// 收集条目处理管道的计数值。
+func (sched *myScheduler) collectItems() []metrics.Sample {
+	if !sched.Running() {
+		return nil
+	}
+	counts := sched.itemPipeline.Count()
+	states := []string{"sent", "accepted", "processed", "dropped"}
+	samples := make([]metrics.Sample, 0, len(states))
+	for i, state := range states {
+		samples = append(samples, metrics.Sample{LabelValues: []string{state}, Value: float64(counts[i])})
+	}
+	return samples
+}
+
+// 获得收集条目处理管道各级状态的函数。只有分级的条目处理管道才有这些状态。
+func (sched *myScheduler) collectStages(queue bool) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		if !sched.Running() {
+			return nil
+		}
+		staged, ok := sched.itemPipeline.(itempipeline.StagedItemPipeline)
+		if !ok {
+			return nil
+		}
+		stages := staged.Stages()
+		samples := make([]metrics.Sample, 0, len(stages))
+		for _, stage := range stages {
+			value := float64(stage.Processed)
+			if queue {
+				value = float64(stage.QueueLen)
+			}
+			samples = append(samples, metrics.Sample{LabelValues: []string{stage.Name}, Value: value})
+		}
+		return samples
+	}
+}
@@ -0,0 +1,453 @@
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"webcrawler/base"
+
+	"github.com/kataras/golog"
+)
+
+// 两次快照之间最多记录的日志条数。
+const snapshotInterval = 1000
+
+// 追加日志与快照的存储。
+// 状态的变化被逐条追加到日志文件中；日志达到一定长度之后，
+// 完整的状态会被写入快照文件，日志文件随之被清空。
+// 快照文件与日志文件中的每一行都是一个JSON对象。
+type journal struct {
+	logPath      string        // 日志文件的路径。
+	snapshotPath string        // 快照文件的路径。
+	logFile      *os.File      // 日志文件。
+	writer       *bufio.Writer // 日志文件的写入器。
+	entries      int           // 自上次快照以来的日志条数。
+}
+
+// 打开追加日志与快照的存储。参数name代表文件名的前缀。
+func openJournal(dir string, name string) (*journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	jn := &journal{
+		logPath:      filepath.Join(dir, name+".log"),
+		snapshotPath: filepath.Join(dir, name+".snapshot"),
+	}
+	return jn, nil
+}
+
+// 依次读取快照文件和日志文件中的每一行并调用参数apply。
+// 日志文件末尾不完整的一行（通常由崩溃导致）会被忽略。
+// 读取完毕后，日志文件会被打开以供追加。
+func (jn *journal) load(apply func(line []byte) error) error {
+	for _, path := range []string{jn.snapshotPath, jn.logPath} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		lines := bytes.Split(data, []byte{'\n'})
+		var offset int64
+		for i, line := range lines {
+			if len(bytes.TrimSpace(line)) != 0 {
+				if err := apply(line); err != nil {
+					if path == jn.logPath && i == len(lines)-1 {
+						// 丢弃不完整的最后一行。
+						if err := os.Truncate(path, offset); err != nil {
+							return err
+						}
+						break
+					}
+					return fmt.Errorf("Corrupted journal file '%s' at line %d: %s", path, i+1, err)
+				}
+				if path == jn.logPath {
+					jn.entries++
+				}
+			}
+			offset += int64(len(line)) + 1
+		}
+	}
+	logFile, err := os.OpenFile(jn.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	jn.logFile = logFile
+	jn.writer = bufio.NewWriter(logFile)
+	return nil
+}
+
+// 追加一条日志。结果值表示是否应该生成新的快照。
+func (jn *journal) append(entry interface{}) (bool, error) {
+	if jn.writer == nil {
+		return false, errors.New("The journal is not opened!")
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+	jn.writer.Write(data)
+	jn.writer.WriteByte('\n')
+	if err := jn.writer.Flush(); err != nil {
+		return false, err
+	}
+	jn.entries++
+	return jn.entries >= snapshotInterval, nil
+}
+
+// 生成快照。参数entries代表完整的状态，每个元素会被写为快照文件中的一行。
+// 快照文件被原子地替换之后，日志文件会被清空。
+func (jn *journal) snapshot(entries []interface{}) error {
+	tmpPath := jn.snapshotPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, jn.snapshotPath); err != nil {
+		return err
+	}
+	if jn.logFile != nil {
+		if err := jn.logFile.Truncate(0); err != nil {
+			return err
+		}
+		jn.writer.Reset(jn.logFile)
+	}
+	jn.entries = 0
+	return nil
+}
+
+// 关闭日志文件。
+func (jn *journal) close() error {
+	if jn.logFile == nil {
+		return nil
+	}
+	jn.writer.Flush()
+	err := jn.logFile.Close()
+	jn.logFile = nil
+	jn.writer = nil
+	return err
+}
+
+// 持久化的请求的记录。请求体不会被持久化。
+type requestRecord struct {
+	Method   string                 `json:"method"`
+	URL      string                 `json:"url"`
+	Header   http.Header            `json:"header,omitempty"`
+	Depth    uint32                 `json:"depth"`
+	Priority float64                `json:"priority,omitempty"`
+	Attrs    map[string]interface{} `json:"attrs,omitempty"`
+	// 已重试的次数。
+	Attempt uint32 `json:"attempt,omitempty"`
+	// 最早可被调度的时间，以Unix纳秒表示。
+	NotBefore int64 `json:"notBefore,omitempty"`
+}
+
+// 根据请求生成记录。
+func newRequestRecord(req *base.Request) *requestRecord {
+	httpReq := req.HttpReq()
+	record := &requestRecord{
+		Method:   httpReq.Method,
+		URL:      httpReq.URL.String(),
+		Header:   httpReq.Header,
+		Depth:    req.Depth(),
+		Priority: req.Priority(),
+		Attempt:  req.Attempt(),
+	}
+	if notBefore := req.NotBefore(); !notBefore.IsZero() {
+		record.NotBefore = notBefore.UnixNano()
+	}
+	if attrs := req.Attrs(); len(attrs) > 0 {
+		record.Attrs = attrs
+	}
+	return record
+}
+
+// 根据记录还原请求。
+func (record *requestRecord) request() (*base.Request, error) {
+	httpReq, err := http.NewRequest(record.Method, record.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range record.Header {
+		httpReq.Header[k] = v
+	}
+	req := base.NewRequest(httpReq, record.Depth)
+	req.SetPriority(record.Priority)
+	if record.Attempt > 0 || record.NotBefore != 0 {
+		var notBefore time.Time
+		if record.NotBefore != 0 {
+			notBefore = time.Unix(0, record.NotBefore)
+		}
+		req = req.WithAttempt(record.Attempt, notBefore)
+	}
+	for k, v := range record.Attrs {
+		req.SetAttr(k, v)
+	}
+	return req, nil
+}
+
+// 请求缓存日志的条目。
+type frontierEntry struct {
+	Op  string         `json:"op"`            // 操作，put或done。
+	Seq uint64         `json:"seq"`           // 请求被放入时的序号。
+	Key string         `json:"key"`           // 请求的URL。
+	Req *requestRecord `json:"req,omitempty"` // 请求，仅在put操作中存在。
+}
+
+// 持久化的请求缓存。它包装了另一个请求缓存，并把请求的放入和完成记录到磁盘上。
+// 被取出但尚未完成的请求仍然被视为待处理的，以便在崩溃之后重新调度。
+type persistentCache struct {
+	inner   requestCache              // 被包装的请求缓存。
+	journal *journal                  // 追加日志与快照的存储。
+	pending map[string]*frontierEntry // 待处理的请求，以URL为键。
+	seq     uint64                    // 最近一次放入的序号。
+	mutex   sync.Mutex                // 互斥锁。
+}
+
+// 创建持久化的请求缓存。若数据目录中已有之前的记录，
+// 则其中尚未完成的请求会按照原有的顺序被放入参数inner所代表的请求缓存。
+func newPersistentCache(inner requestCache, dir string) (requestCache, error) {
+	jn, err := openJournal(dir, "frontier")
+	if err != nil {
+		return nil, err
+	}
+	pc := &persistentCache{
+		inner:   inner,
+		journal: jn,
+		pending: make(map[string]*frontierEntry),
+	}
+	err = jn.load(func(line []byte) error {
+		var entry frontierEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		switch entry.Op {
+		case "put":
+			pc.pending[entry.Key] = &entry
+		case "done":
+			delete(pc.pending, entry.Key)
+		default:
+			return fmt.Errorf("Unknown operation '%s'!", entry.Op)
+		}
+		if entry.Seq > pc.seq {
+			pc.seq = entry.Seq
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range pc.sortedPending() {
+		req, err := entry.Req.request()
+		if err != nil {
+			return nil, fmt.Errorf("Can not restore request '%s': %s", entry.Key, err)
+		}
+		inner.put(req)
+	}
+	return pc, nil
+}
+
+// 获得按序号排序的待处理请求。调用方需持有锁或确保没有并发访问。
+func (pc *persistentCache) sortedPending() []*frontierEntry {
+	entries := make([]*frontierEntry, 0, len(pc.pending))
+	for _, entry := range pc.pending {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+	return entries
+}
+
+// 记录一条日志，并在必要时生成快照。调用方需持有锁。
+func (pc *persistentCache) record(entry *frontierEntry) {
+	needSnapshot, err := pc.journal.append(entry)
+	if err == nil && needSnapshot {
+		entries := make([]interface{}, 0, len(pc.pending))
+		for _, e := range pc.sortedPending() {
+			entries = append(entries, e)
+		}
+		err = pc.journal.snapshot(entries)
+	}
+	if err != nil {
+		logPersistError("request cache", err)
+	}
+}
+
+func (pc *persistentCache) put(req *base.Request) bool {
+	if !pc.inner.put(req) {
+		return false
+	}
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	pc.seq++
+	entry := &frontierEntry{
+		Op:  "put",
+		Seq: pc.seq,
+		Key: req.HttpReq().URL.String(),
+		Req: newRequestRecord(req),
+	}
+	pc.pending[entry.Key] = entry
+	pc.record(entry)
+	return true
+}
+
+func (pc *persistentCache) get() *base.Request {
+	return pc.inner.get()
+}
+
+func (pc *persistentCache) drain() []*base.Request {
+	// 被取出的请求仍然是待处理的，以便下次启动时继续爬取。
+	return pc.inner.drain()
+}
+
+func (pc *persistentCache) done(req *base.Request) {
+	pc.inner.done(req)
+	key := req.HttpReq().URL.String()
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if _, ok := pc.pending[key]; !ok {
+		return
+	}
+	delete(pc.pending, key)
+	pc.record(&frontierEntry{Op: "done", Seq: pc.seq, Key: key})
+}
+
+func (pc *persistentCache) capacity() int {
+	return pc.inner.capacity()
+}
+
+func (pc *persistentCache) length() int {
+	return pc.inner.length()
+}
+
+func (pc *persistentCache) close() {
+	pc.inner.close()
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if err := pc.journal.close(); err != nil {
+		logPersistError("request cache", err)
+	}
+}
+
+func (pc *persistentCache) list(limit int) []*base.Request {
+	return pc.inner.list(limit)
+}
+
+func (pc *persistentCache) stats() ReqCacheSnapshot {
+	stats := pc.inner.stats()
+	pc.mutex.Lock()
+	stats.PersistentPending = len(pc.pending)
+	pc.mutex.Unlock()
+	return stats
+}
+
+func (pc *persistentCache) summary() string {
+	pc.mutex.Lock()
+	pending := len(pc.pending)
+	pc.mutex.Unlock()
+	return fmt.Sprintf("%s, persistent pending: %d", pc.inner.summary(), pending)
+}
+
+// 已见URL集合日志的条目。
+type seenEntry struct {
+	Key string `json:"key"`
+}
+
+// 持久化的已见URL集合。由于它只会增长，日志只在启动时被压缩为快照，
+// 以免在爬取过程中反复重写整个集合。
+type urlSetOnDisk struct {
+	urlSetByMap
+	journal *journal   // 追加日志与快照的存储。
+	mutex   sync.Mutex // 写日志时使用的互斥锁。
+}
+
+// 创建持久化的已见URL集合，并载入数据目录中已有的记录。
+func newURLSetOnDisk(dir string) (urlSet, error) {
+	jn, err := openJournal(dir, "seen")
+	if err != nil {
+		return nil, err
+	}
+	us := &urlSetOnDisk{
+		urlSetByMap: urlSetByMap{set: make(map[string]bool)},
+		journal:     jn,
+	}
+	err = jn.load(func(line []byte) error {
+		var entry seenEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		us.set[entry.Key] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if jn.entries >= snapshotInterval {
+		keys := us.keys()
+		sort.Strings(keys)
+		entries := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			entries = append(entries, &seenEntry{Key: k})
+		}
+		if err := jn.snapshot(entries); err != nil {
+			jn.close()
+			return nil, err
+		}
+	}
+	return us, nil
+}
+
+func (us *urlSetOnDisk) commit(key string) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	if _, err := us.journal.append(&seenEntry{Key: key}); err != nil {
+		logPersistError("seen url set", err)
+	}
+}
+
+func (us *urlSetOnDisk) close() error {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	return us.journal.close()
+}
+
+// 获得作业的数据目录。作业ID中的路径分隔符会被替换。
+func jobDir(dataDir string, jobID string) string {
+	jobID = strings.NewReplacer("/", "_", "\\", "_").Replace(jobID)
+	return filepath.Join(dataDir, jobID)
+}
+
+// 记录持久化过程中发生的错误。持久化的失败不会中断爬取流程。
+func logPersistError(target string, err error) {
+	golog.Errorf("Persistence error (%s): %s\n", target, err)
+}
@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"webcrawler/base"
+)
+
+// 按照IP地址限制时解析主机名的超时时间。
+const resolveTimeout = 5 * time.Second
+
+// 主机名解析结果的有效期。解析失败时的有效期较短，以便尽快重试。
+const (
+	resolveTTL        = 10 * time.Minute
+	resolveFailureTTL = time.Minute
+)
+
+// 主机名的解析结果。
+type resolvedKey struct {
+	key     string    // 限制键，即IP地址，解析失败时为主机名。
+	expires time.Time // 过期时间。
+}
+
+// 单个主机（或IP地址）的礼貌状态。
+type hostState struct {
+	active   uint32    // 正在进行的请求数。
+	nextTime time.Time // 下一次允许发出请求的时间。
+}
+
+// 主机礼貌限制器。它限制对同一主机的并发请求数以及两次请求之间的最小间隔。
+type hostLimiter struct {
+	args        base.PolitenessArgs      // 礼貌参数。
+	states      map[string]*hostState    // 各主机的状态。
+	keys        map[string]resolvedKey   // 主机名与限制键（主机名或IP地址）的映射。
+	resolving   map[string]bool          // 正在被解析的主机名。
+	crawlDelays map[string]time.Duration // 由robots.txt指定的各主机的抓取间隔。
+	rwmutex     sync.RWMutex             // 读写锁。
+}
+
+// 创建主机礼貌限制器。
+func newHostLimiter(args base.PolitenessArgs) *hostLimiter {
+	return &hostLimiter{
+		args:        args,
+		states:      make(map[string]*hostState),
+		keys:        make(map[string]resolvedKey),
+		resolving:   make(map[string]bool),
+		crawlDelays: make(map[string]time.Duration),
+	}
+}
+
+// 获得请求的限制键。按照IP地址限制时，主机名会在后台被解析并缓存一段时间，
+// 解析完成之前使用主机名（或已过期的解析结果），因此该方法不会阻塞。
+func (limiter *hostLimiter) keyOf(req *base.Request) string {
+	host := hostOf(req)
+	limiter.rwmutex.RLock()
+	byIP := limiter.args.ByIP()
+	resolved, ok := limiter.keys[host]
+	limiter.rwmutex.RUnlock()
+	if !byIP || net.ParseIP(host) != nil {
+		return host
+	}
+	if ok && time.Now().Before(resolved.expires) {
+		return resolved.key
+	}
+	limiter.rwmutex.Lock()
+	if !limiter.resolving[host] {
+		limiter.resolving[host] = true
+		go limiter.resolve(host)
+	}
+	limiter.rwmutex.Unlock()
+	if ok {
+		return resolved.key
+	}
+	return host
+}
+
+// 解析主机名并缓存结果。
+func (limiter *hostLimiter) resolve(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	resolved := resolvedKey{key: host, expires: time.Now().Add(resolveFailureTTL)}
+	if addrs, err := net.DefaultResolver.LookupHost(ctx, host); err == nil && len(addrs) > 0 {
+		resolved = resolvedKey{key: addrs[0], expires: time.Now().Add(resolveTTL)}
+	}
+	limiter.rwmutex.Lock()
+	defer limiter.rwmutex.Unlock()
+	limiter.keys[host] = resolved
+	delete(limiter.resolving, host)
+}
+
+// 获得某个限制键的状态。调用方需持有写锁。
+func (limiter *hostLimiter) state(key string) *hostState {
+	state, ok := limiter.states[key]
+	if !ok {
+		state = &hostState{}
+		limiter.states[key] = state
+	}
+	return state
+}
+
+// 获得对请求所在主机生效的礼貌参数。调用方需持有锁。
+func (limiter *hostLimiter) limit(req *base.Request) base.HostLimit {
+	host := hostOf(req)
+	limit := limiter.args.Limit(host)
+	if delay := limiter.crawlDelays[host]; delay > limit.Delay {
+		limit.Delay = delay
+	}
+	return limit
+}
+
+// 尝试为请求占用一个名额。若当前不允许向其主机发出请求，则返回false。
+func (limiter *hostLimiter) acquire(key string, req *base.Request) bool {
+	limiter.rwmutex.Lock()
+	defer limiter.rwmutex.Unlock()
+	state := limiter.state(key)
+	limit := limiter.limit(req)
+	now := time.Now()
+	if now.Before(state.nextTime) {
+		return false
+	}
+	if limit.MaxConcurrency > 0 && state.active >= limit.MaxConcurrency {
+		return false
+	}
+	state.active++
+	state.nextTime = now.Add(limit.Delay)
+	return true
+}
+
+// 释放请求占用的名额。
+func (limiter *hostLimiter) release(key string) {
+	limiter.rwmutex.Lock()
+	defer limiter.rwmutex.Unlock()
+	if state, ok := limiter.states[key]; ok && state.active > 0 {
+		state.active--
+	}
+}
+
+// 设置由robots.txt指定的抓取间隔。生效的间隔取它与礼貌参数中间隔的较大值。
+func (limiter *hostLimiter) setCrawlDelay(host string, delay time.Duration) {
+	limiter.rwmutex.Lock()
+	defer limiter.rwmutex.Unlock()
+	limiter.crawlDelays[host] = delay
+}
+
+// 替换礼貌参数。已有的主机状态会被保留。
+func (limiter *hostLimiter) setArgs(args base.PolitenessArgs) {
+	limiter.rwmutex.Lock()
+	defer limiter.rwmutex.Unlock()
+	limiter.args = args
+}
+
+// 获得礼貌参数。
+func (limiter *hostLimiter) getArgs() base.PolitenessArgs {
+	limiter.rwmutex.RLock()
+	defer limiter.rwmutex.RUnlock()
+	return limiter.args
+}
+
+// 获得已知主机的数量和正在进行的请求的数量。
+func (limiter *hostLimiter) stats() (hosts int, active uint32) {
+	limiter.rwmutex.RLock()
+	defer limiter.rwmutex.RUnlock()
+	for _, state := range limiter.states {
+		active += state.active
+	}
+	return len(limiter.states), active
+}
+
+func (limiter *hostLimiter) summary() string {
+	limiter.rwmutex.RLock()
+	defer limiter.rwmutex.RUnlock()
+	var active uint32
+	for _, state := range limiter.states {
+		active += state.active
+	}
+	return fmt.Sprintf("hosts: %d, active: %d", len(limiter.states), active)
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"webcrawler/base"
+
+	"github.com/kataras/golog"
+)
+
+// 计算第attempt次重试之前的等待时间。
+// 等待时间按照指数增长，并在[d/2, d]之间随机抖动，其中d不超过最大等待时间。
+func backoff(args *base.RetryArgs, attempt uint32) time.Duration {
+	delay := args.BaseDelay()
+	for i := uint32(1); i < attempt && delay < args.MaxDelay(); i++ {
+		delay *= 2
+	}
+	if delay > args.MaxDelay() {
+		delay = args.MaxDelay()
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// 解析响应中的Retry-After头。它的值可以是秒数或者HTTP日期。
+// 若该头不存在或无效，则第二个结果值为false。
+func retryAfter(httpResp *http.Response) (time.Duration, bool) {
+	value := strings.TrimSpace(httpResp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// 服务器关闭了空闲的长连接时HTTP客户端给出的错误信息。对应的错误值没有被导出。
+const serverClosedIdle = "server closed idle connection"
+
+// 判断下载过程中发生的错误是否是暂时性的，即重试后有可能成功。
+// 超时、暂时性的DNS解析失败、连接被重置、拒绝或中断以及复用的长连接被服务器关闭都被视为暂时性错误，
+// 被*url.Error包装的这些错误也是如此。
+// 像无效的URL、不支持的协议或TLS证书错误这样的错误重试多少次都不会成功。
+func transient(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), serverClosedIdle)
+}
+
+// 为下载失败的请求生成重试的副本。参数httpResp为nil时表示下载过程中发生了错误。
+// 若请求不应或不能再被重试，则结果值为nil，错误值说明了放弃的原因。
+func (sched *myScheduler) retryOf(req *base.Request, httpResp *http.Response) (*base.Request, error) {
+	args := sched.retryArgs
+	if args == nil {
+		return nil, nil
+	}
+	reqUrl := req.HttpReq().URL
+	if req.Attempt() >= args.MaxRetries() {
+		return nil, fmt.Errorf("Give up the request after %d retries. (requestUrl=%s)", req.Attempt(), reqUrl)
+	}
+	attempt := req.Attempt() + 1
+	delay := backoff(args, attempt)
+	if httpResp != nil {
+		if after, ok := retryAfter(httpResp); ok {
+			if after > args.MaxDelay() {
+				return nil, fmt.Errorf("Give up the request! The server asked to retry after %s. (requestUrl=%s)",
+					after, reqUrl)
+			}
+			delay = after
+		}
+	}
+	golog.Warnf("Retry the request in %s (attempt %d/%d). (requestUrl=%s)\n",
+		delay, attempt, args.MaxRetries(), reqUrl)
+	return req.WithAttempt(attempt, time.Now().Add(delay)), nil
+}
+
+// 把需要重试的请求放回请求缓存。这会绕过已见URL集合的去重。
+func (sched *myScheduler) requeue(req base.Request) bool {
+	if sched.stopSign.Signed() {
+		sched.stopSign.Deal(SCHEDULER_CODE)
+		return false
+	}
+	if sched.isDraining() {
+		golog.Warnf("Ignore the retry! The scheduler is shutting down. (requestUrl=%s)\n", req.HttpReq().URL)
+		sched.tracker.reject(req)
+		sched.filtered(&req, FILTER_SHUTDOWN, "the scheduler is shutting down")
+		return false
+	}
+	if !sched.reqCache.put(&req) {
+		return false
+	}
+	sched.queued(&req)
+	return true
+}
@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"webcrawler/base"
+	"webcrawler/robots"
+
+	"github.com/kataras/golog"
+)
+
+// 请求附加属性的键：该请求是否来自robots.txt中声明的Sitemap。
+const ATTR_SITEMAP = "robots.sitemap"
+
+const (
+	// robots.txt的缓存有效期。
+	robotsTTL = 24 * time.Hour
+	// 获取robots.txt失败之后再次获取之前的时间。
+	robotsErrorTTL = time.Minute
+	// 获取robots.txt时等待礼貌限制器的轮询间隔。
+	robotsAcquireInterval = 50 * time.Millisecond
+)
+
+// 获取robots.txt的函数的类型。
+type fetchRobots func(req base.Request) (*base.Response, error)
+
+// 获取到某站点的robots.txt之后调用的函数的类型。参数reqUrl代表触发获取的请求的URL。
+type robotsFetched func(reqUrl *url.URL, group *robots.Group, result *robots.Robots)
+
+// 单个站点的robots.txt缓存项。
+type robotsEntry struct {
+	group   *robots.Group // 适用于本爬虫的规则组，尚未成功获取时为nil。
+	expires time.Time     // 失效的时间。获取失败时为下次获取的时间。
+	loading bool          // 是否正在获取。
+}
+
+// robots.txt检查器。它按站点在后台获取并缓存robots.txt，同一站点同时只会获取一次。
+type robotsChecker struct {
+	userAgent string                  // 用户代理。
+	fetch     fetchRobots             // 获取函数。
+	fetched   robotsFetched           // 获取完成后调用的函数，可能为nil。
+	entries   map[string]*robotsEntry // 各站点的缓存项。
+	mutex     sync.Mutex              // 互斥锁。
+}
+
+// 创建robots.txt检查器。
+func newRobotsChecker(userAgent string, fetch fetchRobots, fetched robotsFetched) *robotsChecker {
+	return &robotsChecker{
+		userAgent: userAgent,
+		fetch:     fetch,
+		fetched:   fetched,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+// 获得某个URL所在站点的缓存项。若尚未获取其站点的robots.txt或者缓存已失效，则会在后台获取。
+// 调用方需持有锁。
+func (rc *robotsChecker) entryOf(reqUrl *url.URL) *robotsEntry {
+	origin := strings.ToLower(reqUrl.Scheme + "://" + reqUrl.Host)
+	entry, ok := rc.entries[origin]
+	if !ok {
+		entry = &robotsEntry{}
+		rc.entries[origin] = entry
+	}
+	if !entry.loading && !time.Now().Before(entry.expires) {
+		entry.loading = true
+		triggerUrl := *reqUrl
+		go rc.refresh(origin, &triggerUrl, entry)
+	}
+	return entry
+}
+
+// 获得适用于某个URL的规则组。该方法不会阻塞，失效的规则组在重新获取完成之前仍然会被使用。
+// 若还没有成功获取过其站点的robots.txt，则第二个结果值为false。
+func (rc *robotsChecker) lookup(reqUrl *url.URL) (*robots.Group, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	entry := rc.entryOf(reqUrl)
+	return entry.group, entry.group != nil
+}
+
+// 判断请求是否可以被调度，即其站点的robots.txt已被成功获取且没有正在重新获取。
+// 在此之前请求缓存会扣留其所在的队列，使得获取robots.txt不必与这些请求争抢礼貌限制的名额。
+func (rc *robotsChecker) ready(req *base.Request) bool {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	entry := rc.entryOf(req.HttpReq().URL)
+	return entry.group != nil && !entry.loading
+}
+
+// 获取某个站点的robots.txt并更新其缓存项。
+// 获取失败时保留原有的规则组（可能为nil），并在一段时间之后再次获取。
+func (rc *robotsChecker) refresh(origin string, reqUrl *url.URL, entry *robotsEntry) {
+	result, ok := rc.load(origin)
+	if !ok {
+		rc.mutex.Lock()
+		entry.expires = time.Now().Add(robotsErrorTTL)
+		entry.loading = false
+		rc.mutex.Unlock()
+		return
+	}
+	group := result.Group(rc.userAgent)
+	rc.mutex.Lock()
+	entry.group = group
+	entry.expires = time.Now().Add(robotsTTL)
+	entry.loading = false
+	rc.mutex.Unlock()
+	if rc.fetched != nil {
+		rc.fetched(reqUrl, group, result)
+	}
+}
+
+// 获取并解析某个站点的robots.txt。
+// 若发生网络错误或者服务器暂时无法给出结果（状态码不是2xx或4xx），则第二个结果值为false。
+func (rc *robotsChecker) load(origin string) (*robots.Robots, bool) {
+	robotsUrl := origin + "/robots.txt"
+	httpReq, err := http.NewRequest("GET", robotsUrl, nil)
+	if err != nil {
+		golog.Warnf("Can not create the robots.txt request: %s (url=%s)\n", err, robotsUrl)
+		return nil, false
+	}
+	httpReq.Header.Set("User-Agent", rc.userAgent)
+	resp, err := rc.fetch(*base.NewRequest(httpReq, 0))
+	if err != nil {
+		golog.Warnf("Can not fetch the robots.txt: %s (url=%s)\n", err, robotsUrl)
+		return nil, false
+	}
+	httpResp := resp.HttpResp()
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode < 200 || (httpResp.StatusCode >= 300 && httpResp.StatusCode < 400) ||
+		httpResp.StatusCode >= 500 {
+		golog.Warnf("Can not fetch the robots.txt: %s (url=%s)\n", httpResp.Status, robotsUrl)
+		return nil, false
+	}
+	return robots.FromResponse(httpResp.StatusCode, httpResp.Body), true
+}
+
+func (rc *robotsChecker) stats() *RobotsSnapshot {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return &RobotsSnapshot{UserAgent: rc.userAgent, Sites: len(rc.entries)}
+}
+
+func (rc *robotsChecker) summary() string {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return fmt.Sprintf("user agent: %s, sites: %d", rc.userAgent, len(rc.entries))
+}
+
+// 获取robots.txt。它使用单独的网页下载器，不会占用下载器池，
+// 并且与普通请求一样受礼貌限制器的约束。
+func (sched *myScheduler) fetchRobots(req base.Request) (*base.Response, error) {
+	if sched.limiter != nil {
+		key := sched.limiter.keyOf(&req)
+		for !sched.limiter.acquire(key, &req) {
+			select {
+			case <-time.After(robotsAcquireInterval):
+			case <-sched.done:
+				return nil, errors.New("The scheduler has been stopped!")
+			}
+		}
+		defer sched.limiter.release(key)
+	}
+	return sched.robotsDownloader.Download(req)
+}
+
+// 获取到某站点的robots.txt之后，把其中的Crawl-delay交给礼貌限制器，
+// 并把其中声明的Sitemap作为深度为0的种子请求放入请求缓存。
+func (sched *myScheduler) robotsFetched(reqUrl *url.URL, group *robots.Group, result *robots.Robots) {
+	if delay, ok := group.CrawlDelay(); ok && sched.limiter != nil {
+		sched.limiter.setCrawlDelay(strings.ToLower(reqUrl.Hostname()), delay)
+	}
+	sched.queueSitemaps(result.Sitemaps)
+}
+
+// 检查请求是否被robots.txt允许。该方法不会阻塞：
+// 若尚未成功获取请求所在站点的robots.txt，则不做检查，此时robots.txt会在后台被获取，
+// 而请求缓存会在获取成功之后才调度该请求。
+func (sched *myScheduler) checkRobots(req *base.Request) error {
+	reqUrl := req.HttpReq().URL
+	group, ready := sched.robots.lookup(reqUrl)
+	if ready && !group.Allowed(reqUrl) {
+		return fmt.Errorf("It's disallowed by robots.txt for user agent '%s'.", sched.robots.userAgent)
+	}
+	return nil
+}
+
+// 把Sitemap的URL作为种子请求放入请求缓存。
+func (sched *myScheduler) queueSitemaps(sitemaps []string) {
+	for _, sitemap := range sitemaps {
+		httpReq, err := http.NewRequest("GET", sitemap, nil)
+		if err != nil {
+			golog.Warnf("Ignore the sitemap! %s (url=%s)\n", err, sitemap)
+			continue
+		}
+		req := base.NewRequest(httpReq, 0)
+		req.SetAttr(ATTR_SITEMAP, true)
+		sched.saveReqToCache(*req, nil, SCHEDULER_CODE)
+	}
+}
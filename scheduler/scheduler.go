@@ -1,18 +1,22 @@
 package scheduler
 
 import (
+	"context"
 	"webcrawler/base"
 	"net/http"
 	"webcrawler/analyzer"
 	"webcrawler/itempipeline"
 	"webcrawler/middleware"
+	"webcrawler/deadletter"
 	"webcrawler/downloader"
+	"webcrawler/metrics"
 	"fmt"
+	"io"
 	"github.com/kataras/golog"
 	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
-	"strings"
 )
 
 // 组件的统一代号。
@@ -27,10 +31,32 @@ const (
 type GenHttpClient func() *http.Client
 
 type Scheduler interface {
+	//只爬取与首个请求处于同一主域名下的网页。需要其他爬取范围策略时,
+	//应使用NewSchedulerWithConfig或NewSchedulerWithOptions创建调度器并调用Run
 	Start(channelArgs base.ChannelArgs, poolBaseArgs base.PoolBaseArgs, crawDepth uint32,
 		httpClientGenerator GenHttpClient, respParsers []analyzer.ParseResponse,
 		item []itempipeline.ProcessItem, firstHttpReq *http.Request) (err error)
+	//与Start相同,但当参数ctx被取消时调度器会立即停止
+	StartContext(ctx context.Context, channelArgs base.ChannelArgs, poolBaseArgs base.PoolBaseArgs,
+		crawDepth uint32, httpClientGenerator GenHttpClient,
+		respParsers []analyzer.ParseResponse, item []itempipeline.ProcessItem,
+		firstHttpReq *http.Request) (err error)
+	//按照创建时给定的配置启动调度器,它与Start一样不会阻塞。当参数ctx被取消时调度器会立即停止。
+	//只有通过NewSchedulerWithConfig或NewSchedulerWithOptions创建的调度器才能调用它
+	Run(ctx context.Context) error
+	//立即停止调度器,在途的工作会被放弃
 	Stop() bool
+	//优雅地关闭调度器:不再接受新的请求,并等待在途的下载、分析和条目处理完成,
+	//直到参数ctx被取消为止。结果值中记录了被放弃的工作。
+	//若在排空完成之前ctx被取消,则错误值为ctx.Err()
+	Shutdown(ctx context.Context) (*ShutdownReport, error)
+	//暂停调度器:不再从请求缓存中调度请求,在途的工作会继续完成。
+	//若调度器未在运行、正在关闭或已被暂停,则返回false
+	Pause() bool
+	//恢复被暂停的调度器。若调度器未被暂停,则返回false
+	Resume() bool
+	//判断调度器是否处于暂停状态。暂停状态下Running()仍然返回true
+	Paused() bool
 
 	Running() bool
 	//错误通道,若为nil 表示通道不可用或者调度器处于停止状态
@@ -39,30 +65,141 @@ type Scheduler interface {
 	Idle() bool
 	//摘要信息
 	Summary(prefix string) SchedSummary
+	//获得结构化的快照,它可以被序列化为JSON
+	Snapshot() *SchedSnapshot
+	//设置URL协议策略,只能在调度器启动之前调用。若参数为nil则使用默认策略(只允许http和https)
+	SetSchemePolicy(policy SchemePolicy) error
+	//设置持久化参数,只能在调度器启动之前调用。
+	//请求缓存和已见URL集合会被保存在dataDir下以jobID命名的目录中,
+	//使用相同参数启动的调度器会从上次中断的地方继续爬取。若dataDir为空则不进行持久化
+	SetPersistence(dataDir string, jobID string) error
+	//设置请求缓存的调度策略,只能在调度器启动之前调用。
+	//若参数为nil则请求缓存会严格地先进先出
+	SetFrontierStrategy(strategy *FrontierStrategy) error
+	//设置针对每个主机的礼貌参数(并发数上限和请求间隔),由请求缓存负责执行。
+	//若在调度器启动之前调用,则调度器会启用礼貌限制;
+	//若在运行期间调用,则只有在启动时已启用礼貌限制的情况下才会生效
+	SetPoliteness(args base.PolitenessArgs) error
+	//设置遵守robots.txt时使用的用户代理,只能在调度器启动之前调用。
+	//调度器会按照与该用户代理匹配的规则组过滤请求,并把其中的Crawl-delay交给礼貌限制。
+	//若参数为空则不遵守robots.txt
+	SetRobots(userAgent string) error
+	//设置重试参数,只能在调度器启动之前调用。下载失败的请求会在等待一段时间之后被放回请求缓存,
+	//等待期间不会占用网页下载器。若参数为nil则不进行重试
+	SetRetry(args *base.RetryArgs) error
+	//设置解析函数路由器,只能在调度器启动之前调用。
+	//每个响应都会先交给Start中给定的解析函数,再交给路由器所匹配的各个路由中的解析函数。若参数为nil则不进行路由
+	SetRouter(router analyzer.Router) error
+	//设置分级的条目处理管道,只能在调度器启动之前调用。
+	//每一级都有自己的工作协程和有界队列,管道繁忙时条目通道会被阻塞,从而使压力传递到上游。
+	//设置之后Start中的条目处理函数列表必须为空。若参数为空则Start中的每个条目处理函数都会成为单独的一级(一个工作协程)
+	SetItemStages(stages []itempipeline.Stage) error
+	//设置死信存储,只能在调度器启动之前调用。下载彻底失败的请求和处理失败的条目会被保存在其中。
+	//调度器不会关闭它,需要时可使用RegisterCloser。若参数为nil则不保存死信
+	SetDeadLetter(store deadletter.Store) error
+	//把死信重新放入正在运行的调度器。请求会被放回请求缓存,条目会被重新发送给条目处理管道。
+	//结果值代表被接受的死信的数量
+	Replay(entries []*deadletter.Entry) (int, error)
+	//把调度器的指标注册到参数registry中,只能在调度器启动之前调用,且对同一个注册表只能调用一次。
+	//可使用registry.Listen在本地地址上以Prometheus文本格式提供这些指标。若参数为nil则不记录指标
+	SetMetrics(registry *metrics.Registry) error
+	//向正在运行的调度器添加种子请求,它们的深度为0。爬取范围会随之扩展。结果值代表被接受的请求的数量
+	AddSeeds(httpReqs ...*http.Request) (int, error)
+	//替换正在运行的调度器的爬取范围策略,新策略会以全部种子请求初始化。
+	//已在请求缓存中的请求不受影响
+	SetScope(scope ScopePolicy) error
+	//获得当前的爬取范围策略
+	Scope() ScopePolicy
+	//按照大致的调度顺序列出请求缓存中的请求,但不取出它们。参数limit为0时表示不限数量
+	Frontier(limit int) []base.Request
+	//获得最近发送到错误通道的错误,从旧到新排列
+	RecentErrors() []base.CrawlerError
+	//获得已见URL集合中的所有URL键
+	SeenURLs() []string
+	//注册事件监听器,只能在调度器启动之前调用。每个监听器都有长度为buffer的事件缓冲区(0表示DEFAULT_EVENT_BUFFER),
+	//事件会被异步地交给它,缓冲区已满时新的事件会被丢弃,以免阻塞爬取流程。
+	//参数types代表关注的事件类型,为空表示全部
+	AddListener(listener Listener, buffer int, types ...EventType) error
+	//注册在调度器关闭时需要被关闭的资源(例如条目输出)。
+	//它们会在在途的工作结束之后按照注册的相反顺序被关闭
+	RegisterCloser(closer io.Closer)
 }
 
 //创建调度器
 func NewScheduler() Scheduler {
-	return &myScheduler{}
+	return &myScheduler{schemePolicy: NewSchemePolicy(false)}
 }
 type myScheduler struct {
 	channelArgs   base.ChannelArgs
 	poolBaseArgs  base.PoolBaseArgs
 	crawlDepth    uint32
-	primaryDomain string //主域名
+	scopePolicy   ScopePolicy  //爬取范围策略
+	scopeLock     sync.RWMutex //保护爬取范围策略的读写锁
+	seeds         []*base.Request //种子请求
+	recentErrors  *errorRing   //最近的错误
+	schemePolicy  SchemePolicy //URL协议策略
 	chanman       middleware.ChannelManager
 	stopSign      middleware.StopSign
 	dlpool        downloader.PageDownloaderPool
 	analyzerPool  analyzer.AnalyzerPool
 	itemPipeline  itempipeline.ItemPipeline
-	reqCahce      requestCache
-	urlMap        map[string]bool
+	reqCache      requestCache
+	urlSet        urlSet        //已见URL集合
+	dataDir       string        //持久化数据目录
+	jobID         string        //作业ID
+	strategy      *FrontierStrategy //请求缓存的调度策略
+	politeness    *base.PolitenessArgs //礼貌参数,为nil表示不启用礼貌限制
+	limiter       *hostLimiter      //主机礼貌限制器
+	userAgent     string            //遵守robots.txt时使用的用户代理,为空表示不遵守
+	robots        *robotsChecker    //robots.txt检查器
+	robotsDownloader downloader.PageDownloader //获取robots.txt使用的网页下载器
+	retryArgs     *base.RetryArgs   //重试参数,为nil表示不重试
+	router        analyzer.Router   //解析函数路由器
+	itemStages    []itempipeline.Stage //条目处理管道的各级,为空表示使用条目处理函数列表
+	deadLetters   deadletter.Store  //死信存储,为nil表示不保存死信
+	metrics       *crawlerMetrics   //指标,为nil表示不记录指标
+	config        *Config           //创建时给定的配置,为nil表示使用Start启动
+	listeners     []subscription    //已注册的事件监听器
+	events        *eventBus         //事件总线,为nil表示没有监听器
+	closers       []io.Closer       //调度器关闭时需要被关闭的资源
+	closerLock    sync.Mutex        //保护closers的互斥锁
 	running       uint32
+	draining      uint32        //是否正在排空,1表示是
+	paused        uint32        //是否已被暂停,1表示是
+	tracker       *workTracker  //在途工作的跟踪器
+	done          chan struct{} //关闭通道前被关闭,用于唤醒阻塞中的发送方
+	chanLock      sync.RWMutex  //发送方持有读锁,关闭通道时持有写锁
+	stopLock      sync.Mutex    //保证关闭流程只执行一次
 }
 
 func (sched *myScheduler) Start(channelArgs base.ChannelArgs, poolBaseArgs base.PoolBaseArgs, crawDepth uint32,
 	httpClientGenerator GenHttpClient, respParsers []analyzer.ParseResponse,
 	item []itempipeline.ProcessItem, firstHttpReq *http.Request) (err error) {
+	return sched.StartContext(context.Background(), channelArgs, poolBaseArgs, crawDepth,
+		httpClientGenerator, respParsers, item, firstHttpReq)
+}
+
+func (sched *myScheduler) StartContext(ctx context.Context, channelArgs base.ChannelArgs,
+	poolBaseArgs base.PoolBaseArgs, crawDepth uint32, httpClientGenerator GenHttpClient,
+	respParsers []analyzer.ParseResponse, item []itempipeline.ProcessItem,
+	firstHttpReq *http.Request) (err error) {
+	cfg := &Config{
+		ChannelArgs:         channelArgs,
+		PoolBaseArgs:        poolBaseArgs,
+		CrawlDepth:          crawDepth,
+		Seeds:               []*http.Request{firstHttpReq},
+		HttpClientGenerator: httpClientGenerator,
+		RespParsers:         respParsers,
+		ItemProcessors:      item,
+		ItemStages:          sched.itemStages,
+		Router:              sched.router,
+	}
+	return sched.start(ctx, cfg)
+}
+
+// 按照配置启动调度器。只会使用配置中与Start的参数相对应的字段,
+// 其他功能以调度器上已设置的为准。
+func (sched *myScheduler) start(ctx context.Context, cfg *Config) (err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			errMsg := fmt.Sprintf("Fatal Scheduler Error: %s\n", p)
@@ -70,83 +207,352 @@ func (sched *myScheduler) Start(channelArgs base.ChannelArgs, poolBaseArgs base.
 			err = errors.New(errMsg)
 		}
 	}()
-	if atomic.LoadUint32(&sched.running, ) == 1 {
+	if ctx == nil {
+		return errors.New("The context is invalid!\n")
+	}
+	if atomic.LoadUint32(&sched.running) == 1 {
 		return errors.New("The scheduler has been started!\n")
 	}
-	if err := channelArgs.Check(); err != nil {
+	if err := cfg.Check(); err != nil {
 		return err
 	}
-	sched.channelArgs = channelArgs
-	if err := poolBaseArgs.Check(); err != nil {
+	sched.channelArgs = cfg.ChannelArgs
+	sched.poolBaseArgs = cfg.PoolBaseArgs
+	sched.crawlDepth = cfg.CrawlDepth
+
+	seeds := make([]*base.Request, 0, len(cfg.Seeds))
+	for _, httpReq := range cfg.Seeds {
+		seeds = append(seeds, base.NewRequest(httpReq, 0))
+	}
+	scope := cfg.Scope
+	if scope == nil {
+		scope = NewSameDomainScope()
+	}
+	if err := scope.Init(seeds); err != nil {
 		return err
 	}
-	sched.poolBaseArgs = poolBaseArgs
-	sched.crawlDepth = crawDepth
+	sched.scopePolicy = scope
+	sched.seeds = seeds
+	sched.recentErrors = newErrorRing(recentErrorCapacity)
 
-	sched.chanman = generateChannelManager(channelArgs)
-	if httpClientGenerator == nil {
-		return errors.New("The HTTP client generator list is invalid!")
-	}
-	dlpool, err := generatePageDownloaderPool(poolBaseArgs.PageDownloaderPoolSize(), httpClientGenerator)
+	sched.chanman = generateChannelManager(cfg.ChannelArgs)
+	dlpool, err := generatePageDownloaderPool(cfg.PoolBaseArgs.PageDownloaderPoolSize(), cfg.HttpClientGenerator)
 	if err != nil {
 		errMsg := fmt.Sprintf("Occur error when get page downloader pool:%s\n", err)
 		return errors.New(errMsg)
 	}
 	sched.dlpool = dlpool
 
-	analyzerpool, err := generateAnalyzerPool(poolBaseArgs.AnalyzerPoolSize())
+	analyzerpool, err := generateAnalyzerPool(cfg.PoolBaseArgs.AnalyzerPoolSize())
 	if err != nil {
 		errMsg := fmt.Sprintf("Occur error when get page analyzer pool:%s\n", err)
 		return errors.New(errMsg)
 	}
 	sched.analyzerPool = analyzerpool
-	if item == nil {
-		return errors.New("The item processor list is invalid")
+	respParsers := cfg.RespParsers
+	if sched.router != nil {
+		parsers := make([]analyzer.ParseResponse, 0, len(respParsers)+1)
+		parsers = append(parsers, respParsers...)
+		respParsers = append(parsers, sched.router.Parse)
 	}
-	for i, ip := range item {
-		if ip == nil {
-			return errors.New(fmt.Sprintf("The %dth item processor is invalid!", i))
-		}
+	itemStages := sched.itemStages
+	if len(itemStages) == 0 {
+		itemStages = generateItemStages(cfg.ItemProcessors)
+	}
+	itemPipeline, err := itempipeline.NewStagedItemPipeline(itemStages)
+	if err != nil {
+		return fmt.Errorf("Occur error when get item pipeline:%s\n", err)
 	}
-	sched.itemPipeline = generateItemPipeline(item)
+	sched.itemPipeline = itemPipeline
 
 	if sched.stopSign == nil {
 		sched.stopSign = middleware.NewStopSign()
 	} else {
 		sched.stopSign.Reset()
 	}
-	sched.reqCahce = newRequestCache()
-	sched.urlMap = make(map[string]bool)
+	var innerCache requestCache
+	sched.limiter = nil
+	if sched.politeness != nil {
+		sched.limiter = newHostLimiter(*sched.politeness)
+	} else if sched.userAgent != "" {
+		// robots.txt中的Crawl-delay需要由礼貌限制器执行。
+		sched.limiter = newHostLimiter(base.NewPolitenessArgs(base.HostLimit{}, false, nil))
+	}
+	sched.robots = nil
+	if sched.userAgent != "" {
+		sched.robotsDownloader = downloader.NewPageDownloader(cfg.HttpClientGenerator())
+		sched.robots = newRobotsChecker(sched.userAgent, sched.fetchRobots, sched.robotsFetched)
+	}
+	if sched.limiter != nil {
+		var ready func(req *base.Request) bool
+		if sched.robots != nil {
+			ready = sched.robots.ready
+		}
+		innerCache = newPriorityCache(sched.strategy, sched.limiter, ready)
+	} else if sched.strategy != nil || sched.retryArgs != nil {
+		// 只有按优先级调度的请求缓存才会推迟调度等待重试的请求。
+		innerCache = newPriorityCache(sched.strategy, nil, nil)
+	} else {
+		innerCache = newRequestCache()
+	}
+	if sched.dataDir != "" {
+		dir := jobDir(sched.dataDir, sched.jobID)
+		reqCache, err := newPersistentCache(innerCache, dir)
+		if err != nil {
+			return fmt.Errorf("Can not open persistent request cache: %s\n", err)
+		}
+		urlSet, err := newURLSetOnDisk(dir)
+		if err != nil {
+			reqCache.close()
+			return fmt.Errorf("Can not open persistent url set: %s\n", err)
+		}
+		// 上次可能在请求被放入请求缓存之后、其URL被持久化之前崩溃，因此要补记恢复出来的请求。
+		for _, req := range reqCache.list(0) {
+			if key := sched.schemePolicy.Key(req.HttpReq().URL); urlSet.add(key) {
+				urlSet.commit(key)
+			}
+		}
+		sched.reqCache = reqCache
+		sched.urlSet = urlSet
+	} else {
+		sched.reqCache = innerCache
+		sched.urlSet = newURLSet()
+	}
+	sched.tracker = newWorkTracker()
+	sched.events = newEventBus(sched.listeners)
+	sched.done = make(chan struct{})
+	atomic.StoreUint32(&sched.draining, 0)
+	atomic.StoreUint32(&sched.paused, 0)
 
 	sched.startDownloading()
 	sched.activateAnalyzers(respParsers)
 	sched.openItemPipeline()
 	sched.schedule(10 * time.Millisecond)
 
-	if firstHttpReq == nil {
-		return errors.New("The first HTTP request is invalid!")
+	atomic.StoreUint32(&sched.running, 1)
+	for _, seed := range seeds {
+		sched.saveReqToCache(*seed, nil, SCHEDULER_CODE)
 	}
-	pd,err := getPrimaryDomain(firstHttpReq.Host)
-	if err != nil {
-		return err
-	}
-	sched.primaryDomain = pd
-
-	firstReq := base.NewRequest(firstHttpReq,0)
-	sched.reqCahce.put(firstReq)
 
+	go func(done <-chan struct{}) {
+		select {
+		case <-ctx.Done():
+			sched.Stop()
+		case <-done:
+		}
+	}(sched.done)
 	return nil
 }
 
 func (sched *myScheduler) Stop() bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, _ := sched.Shutdown(ctx)
+	return report != nil
+}
+
+func (sched *myScheduler) Shutdown(ctx context.Context) (*ShutdownReport, error) {
+	sched.stopLock.Lock()
+	defer sched.stopLock.Unlock()
 	if atomic.LoadUint32(&sched.running) != 1 {
-		return false
+		return nil, errors.New("The scheduler is not running!\n")
+	}
+	// 不再接受新的请求,也不再调度请求缓存中的请求。
+	atomic.StoreUint32(&sched.draining, 1)
+	atomic.StoreUint32(&sched.paused, 0)
+	// 等待正在搬运请求的调度流程结束。
+	sched.chanLock.Lock()
+	sched.chanLock.Unlock()
+	report := &ShutdownReport{}
+	var err error
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for sched.tracker.pending() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-ticker.C:
+			continue
+		}
+		break
 	}
+	report.Drained = err == nil
+	// 先唤醒所有阻塞中的发送方,再在没有发送方的情况下关闭通道。
 	sched.stopSign.Sign()
+	close(sched.done)
+	sched.chanLock.Lock()
 	sched.chanman.Close()
-	sched.reqCahce.close()
+	sched.chanLock.Unlock()
+	for _, req := range sched.reqCache.drain() {
+		report.CachedRequests = append(report.CachedRequests, *req)
+	}
+	// 尚未处理完毕的条目会被放弃,并计入报告。
+	sched.itemPipeline.Close()
+	sched.reqCache.close()
+	if err := sched.urlSet.close(); err != nil {
+		golog.Errorf("Occur error when close url set: %s\n", err)
+	}
+	// 监听器可能会使用已注册的资源,因此要先等它们处理完剩余的事件。
+	sched.events.close()
+	sched.closeClosers()
+	sched.tracker.fill(report)
 	atomic.StoreUint32(&sched.running, 2)
-	return true
+	if report.Abandoned() > 0 {
+		golog.Warnf("The scheduler has been shut down. (%s)\n", report)
+	}
+	return report, err
+}
+
+func (sched *myScheduler) Pause() bool {
+	sched.stopLock.Lock()
+	defer sched.stopLock.Unlock()
+	if !sched.Running() || sched.isDraining() {
+		return false
+	}
+	return atomic.CompareAndSwapUint32(&sched.paused, 0, 1)
+}
+
+func (sched *myScheduler) Resume() bool {
+	sched.stopLock.Lock()
+	defer sched.stopLock.Unlock()
+	return atomic.CompareAndSwapUint32(&sched.paused, 1, 0)
+}
+
+func (sched *myScheduler) Paused() bool {
+	return atomic.LoadUint32(&sched.paused) == 1
+}
+
+// 判断调度器是否正在排空。
+func (sched *myScheduler) isDraining() bool {
+	return atomic.LoadUint32(&sched.draining) == 1
+}
+
+func (sched *myScheduler) SetSchemePolicy(policy SchemePolicy) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The scheme policy can not be changed while the scheduler is running!\n")
+	}
+	if policy == nil {
+		policy = NewSchemePolicy(false)
+	}
+	sched.schemePolicy = policy
+	return nil
+}
+
+func (sched *myScheduler) SetPersistence(dataDir string, jobID string) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The persistence can not be changed while the scheduler is running!\n")
+	}
+	if dataDir != "" && jobID == "" {
+		return errors.New("The job ID can not be empty!\n")
+	}
+	sched.dataDir = dataDir
+	sched.jobID = jobID
+	return nil
+}
+
+func (sched *myScheduler) SetFrontierStrategy(strategy *FrontierStrategy) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The frontier strategy can not be changed while the scheduler is running!\n")
+	}
+	sched.strategy = strategy
+	return nil
+}
+
+func (sched *myScheduler) SetPoliteness(args base.PolitenessArgs) error {
+	if err := args.Check(); err != nil {
+		return err
+	}
+	if atomic.LoadUint32(&sched.running) == 1 {
+		if sched.limiter == nil {
+			return errors.New("The politeness was not enabled when the scheduler started!\n")
+		}
+		sched.limiter.setArgs(args)
+	}
+	sched.politeness = &args
+	return nil
+}
+
+func (sched *myScheduler) SetRobots(userAgent string) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The robots.txt user agent can not be changed while the scheduler is running!\n")
+	}
+	sched.userAgent = userAgent
+	return nil
+}
+
+func (sched *myScheduler) SetRetry(args *base.RetryArgs) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The retry args can not be changed while the scheduler is running!\n")
+	}
+	if args != nil {
+		if err := args.Check(); err != nil {
+			return err
+		}
+	}
+	sched.retryArgs = args
+	return nil
+}
+
+func (sched *myScheduler) SetRouter(router analyzer.Router) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The parser router can not be changed while the scheduler is running!\n")
+	}
+	sched.router = router
+	return nil
+}
+
+func (sched *myScheduler) SetItemStages(stages []itempipeline.Stage) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The item stages can not be changed while the scheduler is running!\n")
+	}
+	sched.itemStages = append([]itempipeline.Stage(nil), stages...)
+	return nil
+}
+
+func (sched *myScheduler) SetDeadLetter(store deadletter.Store) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The dead letter store can not be changed while the scheduler is running!\n")
+	}
+	sched.deadLetters = store
+	return nil
+}
+
+func (sched *myScheduler) SetMetrics(registry *metrics.Registry) error {
+	if atomic.LoadUint32(&sched.running) == 1 {
+		return errors.New("The metrics can not be changed while the scheduler is running!\n")
+	}
+	if registry == nil {
+		sched.metrics = nil
+		return nil
+	}
+	m, err := newCrawlerMetrics(sched, registry)
+	if err != nil {
+		return err
+	}
+	sched.metrics = m
+	return nil
+}
+
+func (sched *myScheduler) RegisterCloser(closer io.Closer) {
+	if closer == nil {
+		return
+	}
+	sched.closerLock.Lock()
+	defer sched.closerLock.Unlock()
+	sched.closers = append(sched.closers, closer)
+}
+
+// 按照注册的相反顺序关闭已注册的资源。
+func (sched *myScheduler) closeClosers() {
+	sched.closerLock.Lock()
+	closers := sched.closers
+	sched.closers = nil
+	sched.closerLock.Unlock()
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			golog.Errorf("Occur error when close %T: %s\n", closers[i], err)
+		}
+	}
 }
 
 func (sched *myScheduler) Running() bool {
@@ -164,7 +570,9 @@ func (sched *myScheduler) Idle() bool {
 	idleDlPool := sched.dlpool.Used() == 0
 	idleAnalyzerPool := sched.analyzerPool.Used() == 0
 	idleItemPipeline := sched.itemPipeline.ProcessingNumber() == 0
-	if idleDlPool && idleAnalyzerPool && idleItemPipeline {
+	// 礼貌限制可能会使请求在请求缓存中等待一段时间。
+	idleReqCache := sched.reqCache.length() == 0
+	if idleDlPool && idleAnalyzerPool && idleItemPipeline && idleReqCache {
 		return true
 	}
 	return false
@@ -176,11 +584,12 @@ func (sched *myScheduler) Summary(prefix string) SchedSummary {
 
 
 func (sched *myScheduler) startDownloading() {
+	reqChan := sched.getReqChan()
 	go func() {
-		for {
-			req, ok := <-sched.getReqChan()
-			if !ok {
-				break
+		for req := range reqChan {
+			if sched.stopSign.Signed() {
+				sched.stopSign.Deal(DOWNLOADER_CODE)
+				continue
 			}
 			go sched.download(req)
 		}
@@ -194,6 +603,22 @@ func (sched *myScheduler) download(req base.Request) {
 			golog.Fatal(errMsg)
 		}
 	}()
+	defer sched.tracker.doneDownload(req)
+	// 重试的请求需要在请求缓存得知原请求已完成之后才能被放回。
+	var retry *base.Request
+	defer func() {
+		if retry != nil {
+			sched.requeue(*retry)
+		}
+	}()
+	defer sched.reqCache.done(&req)
+	if sched.robots != nil {
+		if err := sched.checkRobots(&req); err != nil {
+			golog.Warnf("Ignore the request! %s (requestUrl=%s)\n", err, req.HttpReq().URL)
+			sched.filtered(&req, FILTER_ROBOTS, err.Error())
+			return
+		}
+	}
 	download, err := sched.dlpool.Take()
 	if err != nil {
 		errMsg := fmt.Sprintf("Downloader pool error: %s", err)
@@ -208,103 +633,214 @@ func (sched *myScheduler) download(req base.Request) {
 		}
 	}()
 	code := generateCode(DOWNLOADER_CODE, download.Id())
+	start := time.Now()
 	respp, err := download.Download(req)
-	if respp != nil {
-		sched.sendResp(*respp, code)
-	}
 	if err != nil {
-		sched.sendError(err, code)
+		sched.metrics.observeDownload(time.Since(start), 0)
+		if transient(err) {
+			retryReq, retryErr := sched.retryOf(&req, nil)
+			if retryReq != nil {
+				retry = retryReq
+				return
+			}
+			if retryErr != nil {
+				err = fmt.Errorf("%s Last error: %w", retryErr, err)
+			}
+		}
+		sched.saveDeadLetter(deadletter.NewRequestEntry(&req, err, code))
+		sched.sendReqError(err, code, &req, 0)
+		return
+	}
+	if respp == nil {
+		return
+	}
+	httpResp := respp.HttpResp()
+	elapsed := time.Since(start)
+	sched.metrics.observeDownload(elapsed, httpResp.StatusCode)
+	sched.events.response(EVENT_RESPONSE_FETCHED, respp, elapsed)
+	if sched.retryArgs != nil && sched.retryArgs.Retryable(httpResp.StatusCode) {
+		httpResp.Body.Close()
+		retryReq, retryErr := sched.retryOf(&req, httpResp)
+		if retryReq != nil {
+			retry = retryReq
+			return
+		}
+		err := fmt.Errorf("%s Last status: %s", retryErr, httpResp.Status)
+		sched.saveDeadLetter(deadletter.NewRequestEntry(&req, err, code))
+		sched.sendReqError(err, code, &req, httpResp.StatusCode)
+		return
 	}
+	sched.sendResp(*respp, code)
 }
 func (sched *myScheduler) sendResp(resp base.Response, code string) bool {
+	sched.chanLock.RLock()
+	defer sched.chanLock.RUnlock()
 	if sched.stopSign.Signed() {
 		sched.stopSign.Deal(code)
 		return false
 	}
-	sched.getRespChan() <- resp
-	return true
+	sched.tracker.addAnalysis(resp)
+	select {
+	case sched.getRespChan() <- resp:
+		return true
+	case <-sched.done:
+		sched.stopSign.Deal(code)
+		return false
+	}
 }
 // 发送条目。
 func (sched *myScheduler) sendItem(item base.Item, code string) bool {
+	sched.chanLock.RLock()
+	defer sched.chanLock.RUnlock()
 	if sched.stopSign.Signed() {
 		sched.stopSign.Deal(code)
 		return false
 	}
-	sched.getItemChan() <- item
-	return true
+	sched.tracker.addItem(item)
+	select {
+	case sched.getItemChan() <- item:
+		return true
+	case <-sched.done:
+		sched.stopSign.Deal(code)
+		return false
+	}
 }
 // 发送错误。
 func (sched *myScheduler) sendError(err error, code string) bool {
+	return sched.sendErrorWith(err, code, base.ErrorContext{})
+}
+
+// 发送与请求有关的错误。参数statusCode为0表示尚未得到响应。
+func (sched *myScheduler) sendReqError(err error, code string, req *base.Request, statusCode int) bool {
+	ctx := base.ErrorContext{StatusCode: statusCode}
+	if req != nil && req.HttpReq() != nil && req.HttpReq().URL != nil {
+		ctx.URL = req.HttpReq().URL.String()
+		ctx.Depth = req.Depth()
+		ctx.Attempt = req.Attempt()
+	}
+	return sched.sendErrorWith(err, code, ctx)
+}
+
+// 把错误包装为爬虫错误并发送。已经是爬虫错误的错误会被原样发送。
+func (sched *myScheduler) sendErrorWith(err error, code string, ctx base.ErrorContext) bool {
 	if err == nil {
 		return false
 	}
-	codePrefix := parseCode(code)[0]
-	var errorType base.ErrorType
-	switch codePrefix {
-	case DOWNLOADER_CODE:
-		errorType = base.DOWNLOADER_ERROR
-	case ANALYZER_CODE:
-		errorType = base.ANALYZER_ERROR
-	case ITEMPIPELINE_CODE:
-		errorType = base.ITEM_PROCESSOR_ERROR
-	}
-	cError := base.NewCrawlerError(errorType, err.Error())
+	cError, ok := err.(base.CrawlerError)
+	if !ok {
+		ctx.Code = code
+		cError = base.WrapCrawlerError(errorTypeOf(code), err, ctx)
+	}
+	sched.metrics.incErrors(string(cError.Type()))
+	sched.recentErrors.add(cError)
+	sched.events.error(cError)
 	if sched.stopSign.Signed() {
 		sched.stopSign.Deal(code)
 		return false
 	}
 	go func() {
-		sched.getErrorChan() <- cError
+		sched.chanLock.RLock()
+		defer sched.chanLock.RUnlock()
+		if sched.stopSign.Signed() {
+			sched.stopSign.Deal(code)
+			return
+		}
+		select {
+		case sched.getErrorChan() <- cError:
+		case <-sched.done:
+			sched.stopSign.Deal(code)
+		}
 	}()
 	return true
 }
 
 // 把请求存放到请求缓存。
-func (sched *myScheduler) saveReqToCache(req base.Request, code string) bool {
+// 参数parent代表发现该请求的页面所对应的请求，对种子请求而言为nil。
+func (sched *myScheduler) saveReqToCache(req base.Request, parent *base.Request, code string) bool {
 	httpReq := req.HttpReq()
 	if httpReq == nil {
 		golog.Warn("Ignore the request! It's HTTP request is invalid!\n")
+		sched.filtered(&req, FILTER_INVALID, "invalid HTTP request")
 		return false
 	}
 	reqUrl := httpReq.URL
 	if reqUrl == nil {
 		golog.Warn("Ignore the request! It's url is is invalid!\n")
+		sched.filtered(&req, FILTER_INVALID, "invalid url")
+		return false
+	}
+	if err := sched.schemePolicy.Check(reqUrl); err != nil {
+		golog.Warnf("Ignore the request! %s (requestUrl=%s)\n", err, reqUrl)
+		sched.filtered(&req, FILTER_SCHEME, err.Error())
+		return false
+	}
+	urlKey := sched.schemePolicy.Key(reqUrl)
+	if sched.urlSet.has(urlKey) {
+		golog.Warnf("Ignore the request! It's url is repeated. (requestUrl=%s)\n", reqUrl)
+		sched.deduped(&req)
+		return false
+	}
+	if !sched.admit(&req, parent) {
 		return false
 	}
-	if strings.ToLower(reqUrl.Scheme) != "http" {
-		golog.Warnf("Ignore the request! It's url scheme '%s', but should be 'http'!\n", reqUrl.Scheme)
+	if sched.stopSign.Signed() {
+		sched.stopSign.Deal(code)
 		return false
 	}
-	if _, ok := sched.urlMap[reqUrl.String()]; ok {
+	if sched.isDraining() {
+		golog.Warnf("Ignore the request! The scheduler is shutting down. (requestUrl=%s)\n", reqUrl)
+		sched.tracker.reject(req)
+		sched.filtered(&req, FILTER_SHUTDOWN, "the scheduler is shutting down")
+		return false
+	}
+	if sched.strategy != nil && sched.strategy.Score != nil {
+		req.SetPriority(sched.strategy.Score(&req, parent))
+	}
+	if !sched.urlSet.add(urlKey) {
 		golog.Warnf("Ignore the request! It's url is repeated. (requestUrl=%s)\n", reqUrl)
+		sched.deduped(&req)
 		return false
 	}
-	if pd, _ := getPrimaryDomain(httpReq.Host); pd != sched.primaryDomain {
-		golog.Warnf("Ignore the request! It's host '%s' not in primary domain '%s'. (requestUrl=%s)\n",
-			httpReq.Host, sched.primaryDomain, reqUrl)
+	// 先把请求写入请求缓存，再持久化已见URL，这样崩溃时最多只会重复爬取，而不会丢失URL。
+	sched.reqCache.put(&req)
+	sched.urlSet.commit(urlKey)
+	sched.queued(&req)
+	return true
+}
+
+// 检查请求是否在爬取范围、最大深度和robots.txt的限制之内。被过滤的请求会被记录下来。
+func (sched *myScheduler) admit(req *base.Request, parent *base.Request) bool {
+	reqUrl := req.HttpReq().URL
+	if err := sched.checkScope(req, parent); err != nil {
+		golog.Warnf("Ignore the request! It's out of scope: %s (requestUrl=%s)\n", err, reqUrl)
+		sched.filtered(req, FILTER_SCOPE, err.Error())
 		return false
 	}
 	if req.Depth() > sched.crawlDepth {
 		golog.Warnf("Ignore the request! It's depth %d greater than %d. (requestUrl=%s)\n",
 			req.Depth(), sched.crawlDepth, reqUrl)
+		sched.filtered(req, FILTER_DEPTH, fmt.Sprintf("depth %d greater than %d", req.Depth(), sched.crawlDepth))
 		return false
 	}
-	if sched.stopSign.Signed() {
-		sched.stopSign.Deal(code)
-		return false
+	if sched.robots != nil {
+		// 尚未获得robots.txt的请求会在被调度时再次检查。
+		if err := sched.checkRobots(req); err != nil {
+			golog.Warnf("Ignore the request! %s (requestUrl=%s)\n", err, reqUrl)
+			sched.filtered(req, FILTER_ROBOTS, err.Error())
+			return false
+		}
 	}
-	sched.reqCahce.put(&req)
-	sched.urlMap[reqUrl.String()] = true
 	return true
 }
 
 //激活分析器
 func(sched *myScheduler) activateAnalyzers(respParsers []analyzer.ParseResponse) {
+	respChan := sched.getRespChan()
 	go func() {
-		for {
-			resp,ok := <-sched.getRespChan()
-			if !ok {
-				break
+		for resp := range respChan {
+			if sched.stopSign.Signed() {
+				sched.stopSign.Deal(ANALYZER_CODE)
+				continue
 			}
 			go sched.analyze(respParsers,resp)
 		}
@@ -318,6 +854,7 @@ func(sched *myScheduler) analyze(respParsers []analyzer.ParseResponse,resp base.
 			golog.Fatal(errMsg)
 		}
 	}()
+	defer sched.tracker.doneAnalysis(resp)
 	ana, err := sched.analyzerPool.Take()
 	if err != nil {
 		errMsg := fmt.Sprintf("Analyzer pool error: %s", err)
@@ -332,80 +869,106 @@ func(sched *myScheduler) analyze(respParsers []analyzer.ParseResponse,resp base.
 		}
 	}()
 	code := generateCode(ANALYZER_CODE,ana.Id())
-	dataList,errs := ana.Analyzer(respParsers, resp)
+	start := time.Now()
+	dataList,errs := ana.Analyzer(respParsers, &resp)
+	elapsed := time.Since(start)
+	sched.metrics.observeParse(elapsed)
+	sched.events.response(EVENT_RESPONSE_PARSED, &resp, elapsed)
 	if dataList != nil {
 		for _,data := range dataList {
-			if data != nil {
+			if data == nil {
 				continue
 			}
 			switch d:= data.(type) {
 			case *base.Request :
-				sched.saveReqToCache(*d,code)
+				sched.saveReqToCache(*d, resp.Request(), code)
 			case *base.Item:
+				sched.events.item(*d, &resp)
 				sched.sendItem(*d,code)
 			default:
 				errMsg := fmt.Sprintf("Unsupported data type '%T'! (value=%v)\n", d, d)
-				sched.sendError(errors.New(errMsg), code)
+				sched.sendReqError(errors.New(errMsg), code, resp.Request(), resp.HttpResp().StatusCode)
 
 			}
 		}
 	}
 	if errs != nil {
 		for _,err := range errs {
-			sched.sendError(err,code)
+			sched.sendReqError(err, code, resp.Request(), resp.HttpResp().StatusCode)
 		}
 	}
 }
 
 func(sched *myScheduler) openItemPipeline(){
+	itemChan := sched.getItemChan()
 	go func() {
 		sched.itemPipeline.SetFailFast(true)
 		code := ITEMPIPELINE_CODE
-		for item := range sched.getItemChan() {
-			go func(item base.Item) {
-				defer func() {
-					if p := recover(); p != nil{
-						errMsg := fmt.Sprintf("Fatal Item Processing Error: %s\n", p)
-						golog.Fatal(errMsg)
-					}
-				}()
-				errs := sched.itemPipeline.Send(item)
-				if errs != nil {
-					for _,err := range errs {
-						sched.sendError(err,code)
-					}
+		for item := range itemChan {
+			if sched.stopSign.Signed() {
+				sched.stopSign.Deal(code)
+				continue
+			}
+			// 管道繁忙时会在这里阻塞,条目通道随之被填满,分析器的发送也会因此而等待。
+			item := item
+			seq := sched.tracker.claimItem(item)
+			err := sched.itemPipeline.SendAsync(item, func(errs []error) {
+				defer sched.tracker.doneItem(seq)
+				if len(errs) > 0 {
+					sched.saveDeadLetter(deadletter.NewItemEntry(item, errs, code))
+				}
+				for _,err := range errs {
+					sched.sendError(err,code)
 				}
-			}(item)
+			})
+			if err != nil {
+				// 只有在管道已被关闭时才会出错,此时条目仍被视为在途,以便计入关闭报告。
+				sched.sendError(err,code)
+			}
 		}
 	}()
 }
 
 //调度,适当的搬运请求缓存中的请求到请求通道
 func(sched *myScheduler) schedule(interval time.Duration) {
+	reqChan := sched.getReqChan()
 	go func() {
 		for {
 			if sched.stopSign.Signed() {
 				sched.stopSign.Deal(SCHEDULER_CODE)
 				return
 			}
-			remainder := cap(sched.getReqChan()) - len(sched.getReqChan())
-			var temp *base.Request
+			remainder := cap(reqChan) - len(reqChan)
 			for remainder >0 {
-				temp = sched.reqCahce.get()
-				if temp == nil {
+				if !sched.sendReq() {
 					break
 				}
-				if sched.stopSign.Signed() {
-					sched.stopSign.Deal(SCHEDULER_CODE)
-					return
-				}
-				sched.getReqChan() <- *temp
 				remainder--
 			}
 			time.Sleep(interval)
 		}
 	}()
 }
+
+// 从请求缓存中取出一个请求并发送到请求通道。若没有请求可发送则返回false。
+func (sched *myScheduler) sendReq() bool {
+	sched.chanLock.RLock()
+	defer sched.chanLock.RUnlock()
+	if sched.stopSign.Signed() || sched.isDraining() || sched.Paused() {
+		return false
+	}
+	req := sched.reqCache.get()
+	if req == nil {
+		return false
+	}
+	sched.tracker.addDownload(*req)
+	select {
+	case sched.getReqChan() <- *req:
+		return true
+	case <-sched.done:
+		return false
+	}
+}
 // 获取通道管理器持有的请求通道。
 func (sched *myScheduler) getReqChan() chan base.Request {
 	reqChan, err := sched.chanman.ReqChan()
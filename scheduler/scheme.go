@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 默认允许的URL协议及其默认端口。
+var defaultSchemePorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// URL协议策略的接口类型。
+// 它决定哪些协议的请求可以进入请求缓存，以及请求URL在去重时的规范形式。
+type SchemePolicy interface {
+	// 允许一个额外的协议。参数defaultPort代表该协议的默认端口，可以为空。
+	// 只有当生成HTTP客户端的函数所返回的客户端能够处理该协议时
+	// （例如已通过http.Transport.RegisterProtocol注册），才应该允许它。
+	Allow(scheme string, defaultPort string) error
+	// 检查URL的协议是否被允许。若结果值为nil，则说明检查通过。
+	Check(reqUrl *url.URL) error
+	// 获得URL在去重时使用的键。
+	Key(reqUrl *url.URL) string
+	// 获得被允许的协议的列表。
+	Schemes() []string
+	// 判断http和https是否被视为同一个URL。
+	MergeSchemes() bool
+	// 获得字符串表现形式。
+	String() string
+}
+
+// 创建URL协议策略。默认只允许http和https两种协议。
+// 参数mergeSchemes代表在去重时是否把仅协议不同的http和https的URL视为同一个URL。
+func NewSchemePolicy(mergeSchemes bool) SchemePolicy {
+	ports := make(map[string]string)
+	for scheme, port := range defaultSchemePorts {
+		ports[scheme] = port
+	}
+	return &mySchemePolicy{
+		ports:        ports,
+		mergeSchemes: mergeSchemes,
+	}
+}
+
+// URL协议策略的实现类型。
+type mySchemePolicy struct {
+	ports        map[string]string // 被允许的协议与其默认端口的映射。
+	mergeSchemes bool              // 是否合并http和https。
+	rwmutex      sync.RWMutex      // 读写锁。
+}
+
+func (policy *mySchemePolicy) Allow(scheme string, defaultPort string) error {
+	scheme = strings.ToLower(strings.TrimSpace(scheme))
+	if scheme == "" {
+		return errors.New("The scheme is empty!")
+	}
+	if defaultPort != "" {
+		for _, c := range defaultPort {
+			if c < '0' || c > '9' {
+				return fmt.Errorf("Invalid default port '%s' for scheme '%s'!", defaultPort, scheme)
+			}
+		}
+	}
+	policy.rwmutex.Lock()
+	defer policy.rwmutex.Unlock()
+	policy.ports[scheme] = defaultPort
+	return nil
+}
+
+func (policy *mySchemePolicy) Check(reqUrl *url.URL) error {
+	if reqUrl == nil {
+		return errors.New("The url is invalid!")
+	}
+	scheme := strings.ToLower(reqUrl.Scheme)
+	policy.rwmutex.RLock()
+	defer policy.rwmutex.RUnlock()
+	if _, ok := policy.ports[scheme]; !ok {
+		return fmt.Errorf("The url scheme '%s' is not allowed (allowed: %s)!",
+			reqUrl.Scheme, strings.Join(policy.schemes(), ", "))
+	}
+	return nil
+}
+
+func (policy *mySchemePolicy) Key(reqUrl *url.URL) string {
+	if reqUrl == nil {
+		return ""
+	}
+	key := *reqUrl
+	key.Scheme = strings.ToLower(key.Scheme)
+	key.Host = strings.ToLower(key.Host)
+	key.Fragment = ""
+	key.RawFragment = ""
+	policy.rwmutex.RLock()
+	defaultPort := policy.ports[key.Scheme]
+	policy.rwmutex.RUnlock()
+	if host, port, err := net.SplitHostPort(key.Host); err == nil && port == defaultPort {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		key.Host = host
+	}
+	if key.Path == "" {
+		key.Path = "/"
+	}
+	if policy.mergeSchemes && (key.Scheme == "http" || key.Scheme == "https") {
+		// 省略协议，只保留“//host/path”部分。
+		key.Scheme = ""
+	}
+	return key.String()
+}
+
+func (policy *mySchemePolicy) Schemes() []string {
+	policy.rwmutex.RLock()
+	defer policy.rwmutex.RUnlock()
+	return policy.schemes()
+}
+
+// 获得已排序的协议列表。调用方需持有锁。
+func (policy *mySchemePolicy) schemes() []string {
+	schemes := make([]string, 0, len(policy.ports))
+	for scheme := range policy.ports {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func (policy *mySchemePolicy) MergeSchemes() bool {
+	return policy.mergeSchemes
+}
+
+func (policy *mySchemePolicy) String() string {
+	return fmt.Sprintf("{ schemes: [%s], mergeSchemes: %v }",
+		strings.Join(policy.Schemes(), ", "), policy.mergeSchemes)
+}
@@ -0,0 +1,324 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"webcrawler/base"
+	"webcrawler/domain"
+)
+
+// 请求附加属性中记录离站跳数的键。
+const ATTR_SCOPE_HOPS = "scope.hops"
+
+// 爬取范围策略的接口类型。
+type ScopePolicy interface {
+	// 根据种子请求初始化策略。调度器会在启动时调用它，
+	// 在运行期间添加种子或替换策略时也会以全部种子请求再次调用它。
+	Init(seeds []*base.Request) error
+	// 检查请求是否在爬取范围内。
+	// 参数parent代表发现该请求的页面所对应的请求，对种子请求而言为nil。
+	// 若结果值为nil，则说明请求在范围内，否则错误值会说明被排除的原因。
+	Check(req *base.Request, parent *base.Request) error
+	// 获得字符串表现形式。
+	String() string
+}
+
+// 获得请求的主机名（不含端口）。
+func hostOf(req *base.Request) string {
+	return strings.ToLower(req.HttpReq().URL.Hostname())
+}
+
+// 创建只允许与种子请求主机名相同的请求的策略。
+func NewSameHostScope() ScopePolicy {
+	return &sameHostScope{hosts: make(map[string]bool)}
+}
+
+// 同主机范围策略的实现类型。
+type sameHostScope struct {
+	hosts map[string]bool // 种子请求的主机名的集合。
+}
+
+func (scope *sameHostScope) Init(seeds []*base.Request) error {
+	for _, seed := range seeds {
+		scope.hosts[hostOf(seed)] = true
+	}
+	return nil
+}
+
+func (scope *sameHostScope) Check(req *base.Request, parent *base.Request) error {
+	if host := hostOf(req); !scope.hosts[host] {
+		return fmt.Errorf("The host '%s' is not a seed host!", host)
+	}
+	return nil
+}
+
+func (scope *sameHostScope) String() string {
+	return fmt.Sprintf("same-host %v", keysOf(scope.hosts))
+}
+
+// 创建只允许与种子请求处于同一可注册域名（主域名）下的请求的策略。
+// 这也是调度器的默认策略。对于没有可注册域名的种子（例如localhost、IP地址或单标签主机名），
+// 只允许与其主机名完全相同的请求。
+func NewSameDomainScope() ScopePolicy {
+	return &sameDomainScope{domains: make(map[string]bool)}
+}
+
+// 同主域名范围策略的实现类型。
+type sameDomainScope struct {
+	domains map[string]bool // 种子请求的主域名（或没有主域名时的主机名）的集合。
+}
+
+// 获得主机名的主域名。若主机名没有可注册域名，则结果值为主机名本身。
+func primaryDomainOf(host string) string {
+	if pd, err := domain.RegistrableDomain(host); err == nil {
+		return pd
+	}
+	return host
+}
+
+func (scope *sameDomainScope) Init(seeds []*base.Request) error {
+	for _, seed := range seeds {
+		scope.domains[primaryDomainOf(hostOf(seed))] = true
+	}
+	return nil
+}
+
+func (scope *sameDomainScope) Check(req *base.Request, parent *base.Request) error {
+	host := hostOf(req)
+	if !scope.domains[primaryDomainOf(host)] {
+		return fmt.Errorf("The host '%s' not in primary domain %v!", host, keysOf(scope.domains))
+	}
+	return nil
+}
+
+func (scope *sameDomainScope) String() string {
+	return fmt.Sprintf("same-domain %v", keysOf(scope.domains))
+}
+
+// 创建只允许给定域名及其子域名下的请求的策略。
+func NewDomainListScope(domains ...string) ScopePolicy {
+	scope := &domainListScope{domains: make(map[string]bool)}
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			scope.domains[domain] = true
+		}
+	}
+	return scope
+}
+
+// 域名列表范围策略的实现类型。
+type domainListScope struct {
+	domains map[string]bool // 被允许的域名的集合。
+}
+
+func (scope *domainListScope) Init(seeds []*base.Request) error {
+	if len(scope.domains) == 0 {
+		return errors.New("The allowed domain list is empty!")
+	}
+	return nil
+}
+
+func (scope *domainListScope) Check(req *base.Request, parent *base.Request) error {
+	host := hostOf(req)
+	for h := host; h != ""; {
+		if scope.domains[h] {
+			return nil
+		}
+		index := strings.Index(h, ".")
+		if index < 0 {
+			break
+		}
+		h = h[index+1:]
+	}
+	return fmt.Errorf("The host '%s' is not in allowed domains %v!", host, keysOf(scope.domains))
+}
+
+func (scope *domainListScope) String() string {
+	return fmt.Sprintf("domain-list %v", keysOf(scope.domains))
+}
+
+// 创建根据正则表达式匹配完整URL的策略。
+// URL必须匹配参数include中的至少一个表达式（若include为空则视为全部匹配），
+// 并且不能匹配参数exclude中的任何一个表达式。
+func NewRegexpScope(include []string, exclude []string) (ScopePolicy, error) {
+	scope := &regexpScope{}
+	for _, expr := range include {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid include pattern '%s': %s", expr, err)
+		}
+		scope.include = append(scope.include, re)
+	}
+	for _, expr := range exclude {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid exclude pattern '%s': %s", expr, err)
+		}
+		scope.exclude = append(scope.exclude, re)
+	}
+	return scope, nil
+}
+
+// 正则表达式范围策略的实现类型。
+type regexpScope struct {
+	include []*regexp.Regexp // 包含规则。
+	exclude []*regexp.Regexp // 排除规则。
+}
+
+func (scope *regexpScope) Init(seeds []*base.Request) error {
+	return nil
+}
+
+func (scope *regexpScope) Check(req *base.Request, parent *base.Request) error {
+	reqUrl := req.HttpReq().URL.String()
+	for _, re := range scope.exclude {
+		if re.MatchString(reqUrl) {
+			return fmt.Errorf("The url matches exclude pattern '%s'!", re)
+		}
+	}
+	if len(scope.include) == 0 {
+		return nil
+	}
+	for _, re := range scope.include {
+		if re.MatchString(reqUrl) {
+			return nil
+		}
+	}
+	return errors.New("The url matches none of the include patterns!")
+}
+
+func (scope *regexpScope) String() string {
+	return fmt.Sprintf("regexp { include: %v, exclude: %v }", scope.include, scope.exclude)
+}
+
+// 创建只允许给定路径前缀之下的请求的策略。
+// 参数prefixes中的每一项都应是一个绝对URL，例如“https://example.com/docs/”。
+// 若prefixes为空，则使用各种子请求的URL所在的目录作为前缀。
+func NewPathPrefixScope(prefixes ...string) ScopePolicy {
+	return &pathPrefixScope{rawPrefixes: prefixes}
+}
+
+// 路径前缀范围策略的实现类型。
+type pathPrefixScope struct {
+	rawPrefixes []string   // 原始的前缀。
+	prefixes    []*url.URL // 已解析的前缀。
+}
+
+func (scope *pathPrefixScope) Init(seeds []*base.Request) error {
+	scope.prefixes = nil
+	for _, raw := range scope.rawPrefixes {
+		prefix, err := url.Parse(raw)
+		if err != nil || prefix.Host == "" {
+			return fmt.Errorf("Invalid path prefix '%s'!", raw)
+		}
+		scope.prefixes = append(scope.prefixes, prefix)
+	}
+	if len(scope.rawPrefixes) > 0 {
+		return nil
+	}
+	for _, seed := range seeds {
+		prefix := *seed.HttpReq().URL
+		if index := strings.LastIndex(prefix.Path, "/"); index >= 0 {
+			prefix.Path = prefix.Path[:index+1]
+		} else {
+			prefix.Path = "/"
+		}
+		scope.prefixes = append(scope.prefixes, &prefix)
+	}
+	return nil
+}
+
+func (scope *pathPrefixScope) Check(req *base.Request, parent *base.Request) error {
+	reqUrl := req.HttpReq().URL
+	for _, prefix := range scope.prefixes {
+		if strings.EqualFold(reqUrl.Scheme, prefix.Scheme) &&
+			strings.EqualFold(reqUrl.Host, prefix.Host) &&
+			underPath(reqUrl.Path, prefix.Path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("The url is not under any of the path prefixes %v!", scope.prefixes)
+}
+
+// 判断路径path是否在路径前缀prefix之下。前缀只会在路径段的边界上匹配，
+// 例如“/docs”和“/docs/”都匹配“/docs”与“/docs/a”，但不匹配“/docs-old”。
+func underPath(path, prefix string) bool {
+	if path == "" {
+		path = "/"
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || path == prefix+"/" || strings.HasPrefix(path, prefix+"/")
+}
+
+func (scope *pathPrefixScope) String() string {
+	return fmt.Sprintf("path-prefix %v", scope.prefixes)
+}
+
+// 创建不限制域名但限制离站跳数的策略。
+// 种子请求的主域名之内的请求总被允许；离开这些主域名之后，
+// 每经过一个链接跳数加一，跳数超过参数maxHops的请求会被排除。
+func NewUnrestrictedScope(maxHops uint32) ScopePolicy {
+	return &unrestrictedScope{
+		maxHops: maxHops,
+		inner:   NewSameDomainScope(),
+	}
+}
+
+// 限制离站跳数的范围策略的实现类型。
+type unrestrictedScope struct {
+	maxHops uint32      // 最大离站跳数。
+	inner   ScopePolicy // 用于判断请求是否离站的策略。
+}
+
+func (scope *unrestrictedScope) Init(seeds []*base.Request) error {
+	return scope.inner.Init(seeds)
+}
+
+func (scope *unrestrictedScope) Check(req *base.Request, parent *base.Request) error {
+	var hops uint32
+	if scope.inner.Check(req, parent) != nil {
+		hops = 1
+		if parent != nil {
+			if v, ok := parent.Attr(ATTR_SCOPE_HOPS); ok {
+				hops += toUint32(v)
+			}
+		}
+	}
+	if hops > scope.maxHops {
+		return fmt.Errorf("The off-site hops %d greater than %d!", hops, scope.maxHops)
+	}
+	req.SetAttr(ATTR_SCOPE_HOPS, hops)
+	return nil
+}
+
+func (scope *unrestrictedScope) String() string {
+	return fmt.Sprintf("unrestricted { maxHops: %d }", scope.maxHops)
+}
+
+// 把附加属性的值转换为uint32。从磁盘还原的属性值中的数字会是float64类型的。
+func toUint32(v interface{}) uint32 {
+	switch n := v.(type) {
+	case uint32:
+		return n
+	case float64:
+		return uint32(n)
+	case int:
+		return uint32(n)
+	}
+	return 0
+}
+
+// 获得集合中的元素列表。
+func keysOf(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
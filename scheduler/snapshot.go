@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync/atomic"
+	"time"
+	"webcrawler/itempipeline"
+)
+
+// 调度器的结构化快照。它可以被序列化为JSON，以便程序读取。
+type SchedSnapshot struct {
+	Time         time.Time            `json:"time"`                  // 生成快照的时间。
+	Running      bool                 `json:"running"`               // 是否正在运行。
+	Paused       bool                 `json:"paused"`                // 是否已被暂停。
+	Draining     bool                 `json:"draining"`              // 是否正在排空。
+	CrawlDepth   uint32               `json:"crawlDepth"`            // 爬取的最大深度。
+	Channels     []ChannelSnapshot    `json:"channels"`              // 各通道的状态。
+	Pools        []PoolSnapshot       `json:"pools"`                 // 各池的状态。
+	ReqCache     ReqCacheSnapshot     `json:"reqCache"`              // 请求缓存的状态。
+	ItemPipeline ItemPipelineSnapshot `json:"itemPipeline"`          // 条目处理管道的状态。
+	StopSign     StopSignSnapshot     `json:"stopSign"`              // 停止信号的状态。
+	Progress     ProgressSnapshot     `json:"progress"`              // 爬取的进度。
+	Robots       *RobotsSnapshot      `json:"robots,omitempty"`      // robots.txt检查器的状态，未启用时为nil。
+	Routes       map[string]uint64    `json:"routes,omitempty"`      // 解析函数路由器中各路由的匹配计数。
+	DeadLetters  *uint64              `json:"deadLetters,omitempty"` // 已保存的死信的数量，未启用时为nil。
+	Events       *EventsSnapshot      `json:"events,omitempty"`      // 事件总线的状态，没有监听器时为nil。
+}
+
+// 通道的状态。
+type ChannelSnapshot struct {
+	Name     string `json:"name"`
+	Length   int    `json:"length"`
+	Capacity int    `json:"capacity"`
+}
+
+// 池的状态。
+type PoolSnapshot struct {
+	Name  string `json:"name"`
+	Used  uint32 `json:"used"`
+	Total uint32 `json:"total"`
+}
+
+// 请求缓存的状态。
+type ReqCacheSnapshot struct {
+	Status            string `json:"status"`                      // running或closed。
+	Length            int    `json:"length"`                      // 请求的数量。
+	Capacity          int    `json:"capacity"`                    // 容量。
+	Strategy          string `json:"strategy,omitempty"`          // 调度策略的名称。
+	Queues            int    `json:"queues,omitempty"`            // 主机队列的数量。
+	Delayed           int    `json:"delayed,omitempty"`           // 等待重试的请求的数量。
+	Hosts             int    `json:"hosts,omitempty"`             // 礼貌限制器已知的主机的数量。
+	ActiveHosts       uint32 `json:"activeHosts,omitempty"`       // 礼貌限制器中正在进行的请求的数量。
+	PersistentPending int    `json:"persistentPending,omitempty"` // 已持久化但尚未完成的请求的数量。
+}
+
+// 条目处理管道的状态。
+type ItemPipelineSnapshot struct {
+	FailFast   bool                      `json:"failFast"`
+	Sent       uint64                    `json:"sent"`
+	Accepted   uint64                    `json:"accepted"`
+	Processed  uint64                    `json:"processed"`
+	Dropped    uint64                    `json:"dropped"`
+	Processing uint64                    `json:"processing"`
+	Stages     []itempipeline.StageStats `json:"stages,omitempty"` // 仅在使用分级的条目处理管道时存在。
+}
+
+// 停止信号的状态。
+type StopSignSnapshot struct {
+	Signed     bool              `json:"signed"`
+	DealTotal  uint32            `json:"dealTotal"`
+	DealCounts map[string]uint32 `json:"dealCounts,omitempty"` // 各处理方的处理计数。
+}
+
+// 爬取的进度。
+type ProgressSnapshot struct {
+	SeenURLs    int `json:"seenUrls"`    // 已见URL的数量。
+	Downloading int `json:"downloading"` // 在途的下载的数量。
+	Analyzing   int `json:"analyzing"`   // 在途的分析的数量。
+	Items       int `json:"items"`       // 在途的条目的数量。
+}
+
+// 事件总线的状态。
+type EventsSnapshot struct {
+	Listeners int    `json:"listeners"` // 监听器的数量。
+	Delivered uint64 `json:"delivered"` // 已被监听器处理的事件数。
+	Dropped   uint64 `json:"dropped"`   // 因缓冲区已满而被丢弃的事件数。
+}
+
+// robots.txt检查器的状态。
+type RobotsSnapshot struct {
+	UserAgent string `json:"userAgent"`
+	Sites     int    `json:"sites"`
+}
+
+// 序列化为JSON。
+func (snapshot *SchedSnapshot) JSON() ([]byte, error) {
+	return json.Marshal(snapshot)
+}
+
+// 判断是否与另一份快照相同。生成快照的时间不参与比较。
+func (snapshot *SchedSnapshot) Same(other *SchedSnapshot) bool {
+	if snapshot == nil || other == nil {
+		return snapshot == other
+	}
+	a, b := *snapshot, *other
+	a.Time, b.Time = time.Time{}, time.Time{}
+	return reflect.DeepEqual(a, b)
+}
+
+func (sched *myScheduler) Snapshot() *SchedSnapshot {
+	snapshot := &SchedSnapshot{
+		Time:       time.Now(),
+		Running:    sched.Running(),
+		Paused:     sched.Paused(),
+		Draining:   sched.isDraining(),
+		CrawlDepth: sched.crawlDepth,
+	}
+	// 在第一次启动之前，各组件都还不存在。
+	if atomic.LoadUint32(&sched.running) == 0 {
+		return snapshot
+	}
+	if reqChan, err := sched.chanman.ReqChan(); err == nil {
+		respChan, _ := sched.chanman.RespChan()
+		itemChan, _ := sched.chanman.ItemChan()
+		errorChan, _ := sched.chanman.ErrorChan()
+		snapshot.Channels = []ChannelSnapshot{
+			{Name: "request", Length: len(reqChan), Capacity: cap(reqChan)},
+			{Name: "response", Length: len(respChan), Capacity: cap(respChan)},
+			{Name: "item", Length: len(itemChan), Capacity: cap(itemChan)},
+			{Name: "error", Length: len(errorChan), Capacity: cap(errorChan)},
+		}
+	}
+	snapshot.Pools = []PoolSnapshot{
+		{Name: "downloader", Used: sched.dlpool.Used(), Total: sched.dlpool.Total()},
+		{Name: "analyzer", Used: sched.analyzerPool.Used(), Total: sched.analyzerPool.Total()},
+	}
+	snapshot.ReqCache = sched.reqCache.stats()
+	counts := sched.itemPipeline.Count()
+	snapshot.ItemPipeline = ItemPipelineSnapshot{
+		FailFast:   sched.itemPipeline.FailFast(),
+		Sent:       counts[0],
+		Accepted:   counts[1],
+		Processed:  counts[2],
+		Dropped:    counts[3],
+		Processing: sched.itemPipeline.ProcessingNumber(),
+	}
+	if staged, ok := sched.itemPipeline.(itempipeline.StagedItemPipeline); ok {
+		snapshot.ItemPipeline.Stages = staged.Stages()
+	}
+	snapshot.StopSign = StopSignSnapshot{
+		Signed:     sched.stopSign.Signed(),
+		DealTotal:  sched.stopSign.DealTotal(),
+		DealCounts: sched.stopSign.DealCounts(),
+	}
+	snapshot.Progress.SeenURLs = sched.urlSet.length()
+	snapshot.Progress.Downloading, snapshot.Progress.Analyzing, snapshot.Progress.Items = sched.tracker.counts()
+	if sched.robots != nil {
+		snapshot.Robots = sched.robots.stats()
+	}
+	if sched.router != nil {
+		snapshot.Routes = sched.router.Counts()
+	}
+	if sched.deadLetters != nil {
+		count := sched.deadLetters.Count()
+		snapshot.DeadLetters = &count
+	}
+	snapshot.Events = sched.events.stats()
+	return snapshot
+}
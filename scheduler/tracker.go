@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"webcrawler/base"
+)
+
+// 关闭报告，记录了调度器关闭时被放弃的工作。
+type ShutdownReport struct {
+	Drained        bool            // 是否在期限之内完成了排空。
+	CachedRequests []base.Request  // 仍在请求缓存中、尚未被调度的请求。
+	Downloads      []base.Request  // 已被调度但未完成下载的请求。
+	Analyses       []base.Response // 已下载但未完成分析的响应。
+	Items          []base.Item     // 已生成但未完成处理的条目。
+	Rejected       []base.Request  // 排空期间新发现而被拒绝的请求。
+}
+
+// 获得被放弃的工作的总数。
+func (report *ShutdownReport) Abandoned() int {
+	return len(report.CachedRequests) + len(report.Downloads) +
+		len(report.Analyses) + len(report.Items) + len(report.Rejected)
+}
+
+func (report *ShutdownReport) String() string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "drained: %v, abandoned: %d", report.Drained, report.Abandoned())
+	writeReqs := func(name string, reqs []base.Request) {
+		for _, req := range reqs {
+			fmt.Fprintf(&buffer, "\n  %s: %s", name, req.HttpReq().URL)
+		}
+	}
+	writeReqs("cached request", report.CachedRequests)
+	writeReqs("download", report.Downloads)
+	for _, resp := range report.Analyses {
+		fmt.Fprintf(&buffer, "\n  analysis: %s", resp.HttpResp().Request.URL)
+	}
+	for _, item := range report.Items {
+		fmt.Fprintf(&buffer, "\n  item: %v", item)
+	}
+	writeReqs("rejected request", report.Rejected)
+	return buffer.String()
+}
+
+// 在途工作的跟踪器。
+// 一项工作在被发送到下一个环节的通道之前登记，并在该环节处理完毕之后注销。
+type workTracker struct {
+	downloads map[*http.Request]base.Request   // 在途的下载。
+	analyses  map[*http.Response]base.Response // 在途的分析。
+	items     map[uint64]base.Item             // 在途的条目，键为登记时的序号。
+	waiting   map[uintptr][]uint64             // 已登记但尚未被条目处理管道接收的条目的序号，按条目的底层指针分组。
+	itemSeq   uint64                           // 最近一次登记的条目的序号。
+	rejected  []base.Request                   // 被拒绝的请求。
+	mutex     sync.Mutex                       // 互斥锁。
+}
+
+// 创建在途工作的跟踪器。
+func newWorkTracker() *workTracker {
+	return &workTracker{
+		downloads: make(map[*http.Request]base.Request),
+		analyses:  make(map[*http.Response]base.Response),
+		items:     make(map[uint64]base.Item),
+		waiting:   make(map[uintptr][]uint64),
+	}
+}
+
+func (tracker *workTracker) addDownload(req base.Request) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.downloads[req.HttpReq()] = req
+}
+
+func (tracker *workTracker) doneDownload(req base.Request) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.downloads, req.HttpReq())
+}
+
+func (tracker *workTracker) addAnalysis(resp base.Response) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.analyses[resp.HttpResp()] = resp
+}
+
+func (tracker *workTracker) doneAnalysis(resp base.Response) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.analyses, resp.HttpResp())
+}
+
+// 获得条目的底层指针。同一个字典可能被多次发送，因此它只用来在条目通道的两端之间传递序号。
+func itemPointer(item base.Item) uintptr {
+	return reflect.ValueOf(item).Pointer()
+}
+
+// 登记即将被发送到条目通道的条目，并为其分配序号。
+func (tracker *workTracker) addItem(item base.Item) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.itemSeq++
+	tracker.items[tracker.itemSeq] = item
+	ptr := itemPointer(item)
+	tracker.waiting[ptr] = append(tracker.waiting[ptr], tracker.itemSeq)
+}
+
+// 在从条目通道接收到条目时获得其序号。
+// 同一个字典的多次发送彼此无法区分，因此按照登记的顺序依次分配它们的序号。
+func (tracker *workTracker) claimItem(item base.Item) uint64 {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	ptr := itemPointer(item)
+	seqs := tracker.waiting[ptr]
+	if len(seqs) == 0 {
+		return 0
+	}
+	if len(seqs) == 1 {
+		delete(tracker.waiting, ptr)
+	} else {
+		tracker.waiting[ptr] = seqs[1:]
+	}
+	return seqs[0]
+}
+
+// 注销序号为seq的条目。
+func (tracker *workTracker) doneItem(seq uint64) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.items, seq)
+}
+
+func (tracker *workTracker) reject(req base.Request) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.rejected = append(tracker.rejected, req)
+}
+
+// 获得在途工作的数量。
+func (tracker *workTracker) pending() int {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return len(tracker.downloads) + len(tracker.analyses) + len(tracker.items)
+}
+
+// 分别获得在途的下载、分析和条目的数量。
+func (tracker *workTracker) counts() (downloads int, analyses int, items int) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return len(tracker.downloads), len(tracker.analyses), len(tracker.items)
+}
+
+// 把在途工作和被拒绝的请求填入关闭报告。
+func (tracker *workTracker) fill(report *ShutdownReport) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for _, req := range tracker.downloads {
+		report.Downloads = append(report.Downloads, req)
+	}
+	for _, resp := range tracker.analyses {
+		report.Analyses = append(report.Analyses, resp)
+	}
+	for _, item := range tracker.items {
+		report.Items = append(report.Items, item)
+	}
+	report.Rejected = append(report.Rejected, tracker.rejected...)
+}
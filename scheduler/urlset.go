@@ -0,0 +1,69 @@
+package scheduler
+
+import "sync"
+
+// 已见URL集合的接口类型。其中存放的是经过规范化的URL键。
+type urlSet interface {
+	// 添加URL键。若该键已存在，则返回false。
+	add(key string) bool
+	// 持久化已添加的URL键。应在相应的请求被放入请求缓存之后调用，
+	// 以免在两次写入之间崩溃时丢失该URL。
+	commit(key string)
+	// 判断URL键是否已存在。
+	has(key string) bool
+	// 获得URL键的数量。
+	length() int
+	// 获得所有的URL键。
+	keys() []string
+	// 关闭集合并释放其持有的资源。
+	close() error
+}
+
+// 创建只存在于内存中的已见URL集合。
+func newURLSet() urlSet {
+	return &urlSetByMap{set: make(map[string]bool)}
+}
+
+// 已见URL集合的内存实现类型。
+type urlSetByMap struct {
+	set     map[string]bool // URL键的集合。
+	rwmutex sync.RWMutex    // 读写锁。
+}
+
+func (us *urlSetByMap) add(key string) bool {
+	us.rwmutex.Lock()
+	defer us.rwmutex.Unlock()
+	if us.set[key] {
+		return false
+	}
+	us.set[key] = true
+	return true
+}
+
+func (us *urlSetByMap) commit(key string) {}
+
+func (us *urlSetByMap) has(key string) bool {
+	us.rwmutex.RLock()
+	defer us.rwmutex.RUnlock()
+	return us.set[key]
+}
+
+func (us *urlSetByMap) length() int {
+	us.rwmutex.RLock()
+	defer us.rwmutex.RUnlock()
+	return len(us.set)
+}
+
+func (us *urlSetByMap) keys() []string {
+	us.rwmutex.RLock()
+	defer us.rwmutex.RUnlock()
+	keys := make([]string, 0, len(us.set))
+	for k := range us.set {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (us *urlSetByMap) close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"webcrawler/base"
+)
+
+// 无法确定错误类型或主机时使用的分组名称。
+const UNKNOWN_GROUP = "<unknown>"
+
+// 错误统计，按照错误类型和主机对错误进行分组计数。它是并发安全的。
+type ErrorStats struct {
+	total  uint64            // 错误总数。
+	byType map[string]uint64 // 按错误类型分组的计数。
+	byHost map[string]uint64 // 按主机分组的计数。
+	mutex  sync.Mutex        // 互斥锁。
+}
+
+// 创建错误统计。
+func NewErrorStats() *ErrorStats {
+	return &ErrorStats{
+		byType: make(map[string]uint64),
+		byHost: make(map[string]uint64),
+	}
+}
+
+// 记录一个错误。不是爬虫错误的错误会被计入未知的分组。
+func (stats *ErrorStats) Add(err error) {
+	if err == nil {
+		return
+	}
+	errType, host := UNKNOWN_GROUP, UNKNOWN_GROUP
+	var cError base.CrawlerError
+	if errors.As(err, &cError) {
+		if t := cError.Type(); t != "" {
+			errType = string(t)
+		}
+		if h := cError.Context().Host(); h != "" {
+			host = h
+		}
+	}
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	stats.total++
+	stats.byType[errType]++
+	stats.byHost[host]++
+}
+
+// 获得错误总数。
+func (stats *ErrorStats) Total() uint64 {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return stats.total
+}
+
+// 获得按错误类型分组的计数。
+func (stats *ErrorStats) ByType() map[string]uint64 {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return copyCounts(stats.byType)
+}
+
+// 获得按主机分组的计数。
+func (stats *ErrorStats) ByHost() map[string]uint64 {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return copyCounts(stats.byHost)
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	result := make(map[string]uint64, len(counts))
+	for k, v := range counts {
+		result[k] = v
+	}
+	return result
+}
+
+// 获得摘要信息。参数topHosts代表最多列出的主机的数量，计数多的主机优先。
+func (stats *ErrorStats) Summary(topHosts int) string {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return fmt.Sprintf("total: %d, by type: [%s], by host: [%s]",
+		stats.total, formatCounts(stats.byType, 0), formatCounts(stats.byHost, topHosts))
+}
+
+// 把分组计数格式化为字符串，计数多的分组在前。参数limit为0时表示不限数量。
+func formatCounts(counts map[string]uint64, limit int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	omitted := 0
+	if limit > 0 && len(keys) > limit {
+		omitted = len(keys) - limit
+		keys = keys[:limit]
+	}
+	parts := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, counts[k]))
+	}
+	if omitted > 0 {
+		parts = append(parts, fmt.Sprintf("... (%d more)", omitted))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"runtime"
 	"time"
-	"webcrawler/scheduler"
+	sched "webcrawler/scheduler"
 )
 
 // 摘要信息的模板。
 var summaryForMonitoring = "Monitor - Collected information[%d]:\n" +
 	"  Goroutine number: %d\n" +
 	"  Scheduler:\n%s" +
+	"  Errors: %s\n" +
 	"  Escaped time: %s\n"
 
 // 已达到最大空闲计数的消息模板。
@@ -35,12 +36,26 @@ type Record func(level byte, content string)
 // 参数record代表日志记录函数。
 // 当监控结束之后，该方法会会向作为唯一返回值的通道发送一个代表了空闲状态检查次数的数值。
 func Monitoring(
-	scheduler scheduler.Scheduler,
+	scheduler sched.Scheduler,
 	intervalNs time.Duration,
 	maxIdleCount uint,
 	autoStop bool,
 	detailSummary bool,
 	record Record) <-chan uint64 {
+	return MonitoringWithStats(scheduler, intervalNs, maxIdleCount,
+		autoStop, detailSummary, record, nil)
+}
+
+// 与Monitoring相同，但从错误通道接收到的错误会被计入参数stats，以便调用方按照类型和主机查询。
+// 若参数stats为nil则使用内部创建的错误统计。
+func MonitoringWithStats(
+	scheduler sched.Scheduler,
+	intervalNs time.Duration,
+	maxIdleCount uint,
+	autoStop bool,
+	detailSummary bool,
+	record Record,
+	stats *ErrorStats) <-chan uint64 {
 	if scheduler == nil { // 调度器不能不可用！
 		panic(errors.New("The scheduler is invalid!"))
 	}
@@ -51,12 +66,15 @@ func Monitoring(
 	if maxIdleCount < 1000 {
 		maxIdleCount = 1000
 	}
+	if stats == nil {
+		stats = NewErrorStats()
+	}
 	// 监控停止通知器
 	stopNotifier := make(chan byte, 1)
 	// 接收和报告错误
-	reportError(scheduler, record, stopNotifier)
+	reportError(scheduler, record, stats, stopNotifier)
 	// 记录摘要信息
-	recordSummary(scheduler, detailSummary, record, stopNotifier)
+	recordSummary(scheduler, detailSummary, record, stats, stopNotifier)
 	// 检查计数通道
 	checkCountChan := make(chan uint64, 2)
 	// 检查空闲状态
@@ -72,7 +90,7 @@ func Monitoring(
 
 // 检查状态，并在满足持续空闲时间的条件时采取必要措施。
 func checkStatus(
-	scheduler scheduler.Scheduler,
+	scheduler sched.Scheduler,
 	intervalNs time.Duration,
 	maxIdleCount uint,
 	autoStop bool,
@@ -92,8 +110,8 @@ func checkStatus(
 		var idleCount uint
 		var firstIdleTime time.Time
 		for {
-			// 检查调度器的空闲状态
-			if scheduler.Idle() {
+			// 检查调度器的空闲状态。被暂停的调度器不会被视为空闲。
+			if scheduler.Idle() && !scheduler.Paused() {
 				idleCount++
 				if idleCount == 1 {
 					firstIdleTime = time.Now()
@@ -103,7 +121,7 @@ func checkStatus(
 						fmt.Sprintf(msgReachMaxIdleCount, time.Since(firstIdleTime).String())
 					record(0, msg)
 					// 再次检查调度器的空闲状态，确保它已经可以被停止
-					if scheduler.Idle() {
+					if scheduler.Idle() && !scheduler.Paused() {
 						if autoStop {
 							var result string
 							if scheduler.Stop() {
@@ -134,16 +152,18 @@ func checkStatus(
 
 // 记录摘要信息。
 func recordSummary(
-	scheduler scheduler.Scheduler,
+	scheduler sched.Scheduler,
 	detailSummary bool,
 	record Record,
+	stats *ErrorStats,
 	stopNotifier <-chan byte) {
 	go func() {
 		// 等待调度器开启
 		waitForSchedulerStart(scheduler)
 		// 准备
-		var prevSchedSummary scheduler.SchedSummary
+		var prevSchedSummary sched.SchedSummary
 		var prevNumGoroutine int
+		var prevErrorTotal uint64
 		var recordCount uint64 = 1
 		startTime := time.Now()
 		for {
@@ -156,8 +176,10 @@ func recordSummary(
 			// 获取摘要信息的各组成部分
 			currNumGoroutine := runtime.NumGoroutine()
 			currSchedSummary := scheduler.Summary("    ")
+			currErrorTotal := stats.Total()
 			// 比对前后两份摘要信息的一致性。只有不一致时才会予以记录。
 			if currNumGoroutine != prevNumGoroutine ||
+				currErrorTotal != prevErrorTotal ||
 				!currSchedSummary.Same(prevSchedSummary) {
 				schedSummaryStr := func() string {
 					if detailSummary {
@@ -171,10 +193,12 @@ func recordSummary(
 					recordCount,
 					currNumGoroutine,
 					schedSummaryStr,
+					stats.Summary(10),
 					time.Since(startTime).String(),
 				)
 				record(0, info)
 				prevNumGoroutine = currNumGoroutine
+				prevErrorTotal = currErrorTotal
 				prevSchedSummary = currSchedSummary
 				recordCount++
 			}
@@ -185,8 +209,9 @@ func recordSummary(
 
 // 接收和报告错误。
 func reportError(
-	scheduler scheduler.Scheduler,
+	scheduler sched.Scheduler,
 	record Record,
+	stats *ErrorStats,
 	stopNotifier <-chan byte) {
 	go func() {
 		// 等待调度器开启
@@ -204,6 +229,7 @@ func reportError(
 			}
 			err := <-errorChan
 			if err != nil {
+				stats.Add(err)
 				errMsg := fmt.Sprintf("Error (received from error channel): %s", err)
 				record(2, errMsg)
 			}
@@ -213,7 +239,7 @@ func reportError(
 }
 
 // 等待调度器开启。
-func waitForSchedulerStart(scheduler scheduler.Scheduler) {
+func waitForSchedulerStart(scheduler sched.Scheduler) {
 	for !scheduler.Running() {
 		time.Sleep(time.Microsecond)
 	}